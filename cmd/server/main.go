@@ -2,22 +2,46 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"os"
+	"strconv"
 
 	"github.com/webdevelop-pro/go-common/configurator"
 	"github.com/webdevelop-pro/go-common/logger"
 	"github.com/webdevelop-pro/lib/server"
 	"github.com/webdevelop-pro/migration-service/internal/adapters"
-	"github.com/webdevelop-pro/migration-service/internal/adapters/repository/postgres"
+	"github.com/webdevelop-pro/migration-service/internal/adapters/repository"
 	"github.com/webdevelop-pro/migration-service/internal/app"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration"
 	"github.com/webdevelop-pro/migration-service/internal/ports"
 	"github.com/webdevelop-pro/migration-service/internal/services"
 	"go.uber.org/fx"
 )
 
+var (
+	initDB     = flag.Bool("init", false, "initialize service by creating migration table at DB")
+	finalSql   = flag.String("final-sql", "", "if provided - program return final SQL for migrations without applying it. Argument = service name")
+	force      = flag.Bool("force", false, "force apply migration without version checking. Accept files or dir paths. Will not update service version if applied version is lower, then already applied")
+	skip       = flag.Bool("fake", false, "fake do not apply any migration but mark according migrations in migration_services table as completed")
+	check      = flag.Bool("check", false, "check verifies if all hashes of migrations are equal to those in migration table. If no - returns list of files with migrations, that have differences. Can accept files or dirs of migrations as arguments")
+	checkApply = flag.Bool("check-apply", false, "check-apply compares hashes of all migrations with hashes in DB and try to apply those, that have differences. Can accept files or dirs of migrations as arguments")
+	applyOnly  = flag.Bool("apply-only", false, "apply and shutdown migration service, do not start web service")
+	plan       = flag.Bool("plan", false, "plan prints current version, files to apply, files skipped because of required_env and resulting version for every service without applying anything")
+	planFormat = flag.String("plan-format", "text", "output format for --plan: text or json")
+	rollback   = flag.Bool("rollback", false, "rollback runs down migrations of the service in reverse order until target version. Arguments = service name and target version")
+	validate   = flag.Bool("validate", false, "validate checks migrations tree without touching DB and reports all problems: bad file and folder names, duplicated versions, gaps in numbering, empty files, unknown header keys and invalid required_env. Accepts dirs as arguments, MIGRATION_DIR by default")
+)
+
 // @schemes https
 func main() {
+	flag.Parse()
+	if *validate {
+		os.Exit(RunValidate(flag.Args()))
+	}
+
 	log := logger.NewComponentLogger("fx", nil)
 
 	fx.New(
@@ -25,10 +49,8 @@ func main() {
 		fx.Provide(
 			// Configurator
 			configurator.NewConfigurator,
-			// Database connection
-			postgres.New,
-			// Bind DB with Repository interface
-			func(repo *postgres.Repository) adapters.Repository { return repo },
+			// Database connection, chosen by DB_TYPE
+			repository.New,
 			// app
 			app.New,
 			// Bind App with service interface
@@ -56,25 +78,49 @@ func main() {
 	log.Info().Msg("done")
 }
 
-func errorToint(err error) int {
-	if err != nil {
-		return 1
+// Exit codes, so CI and deploy scripts can tell why migration service failed.
+const (
+	exitOK               = 0
+	exitFailed           = 1
+	exitUsage            = 2
+	exitBadFileName      = 3
+	exitBadServiceFolder = 4
+	exitUnreadable       = 5
+	exitDuplicateVersion = 6
+	exitLockTimeout      = 7
+	exitDependency       = 8
+	exitTimeout          = 9
+	exitSchemaVersion    = 10
+)
+
+// exitCode maps error to exit code.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, migration.ErrBadFileName):
+		return exitBadFileName
+	case errors.Is(err, migration.ErrBadServiceFolder):
+		return exitBadServiceFolder
+	case errors.Is(err, migration.ErrUnreadable):
+		return exitUnreadable
+	case errors.Is(err, migration.ErrDuplicateVersion):
+		return exitDuplicateVersion
+	case errors.Is(err, adapters.ErrLockTimeout):
+		return exitLockTimeout
+	case errors.Is(err, migration.ErrDependency):
+		return exitDependency
+	case errors.Is(err, adapters.ErrTimeout):
+		return exitTimeout
+	case errors.Is(err, adapters.ErrSchemaVersion):
+		return exitSchemaVersion
+	default:
+		return exitFailed
 	}
-	return 0
 }
 
 func RunApp(sd fx.Shutdowner, _app *app.App, c *configurator.Configurator, lc fx.Lifecycle, srv *server.HttpServer) {
-	init := flag.Bool("init", false, "initialize service by creating migration table at DB")
-	finalSql := flag.String("final-sql", "", "if provided - program return final SQL for migrations without applying it. Argument = service name")
-	force := flag.Bool("force", false, "force apply migration without version checking. Accept files or dir paths. Will not update service version if applied version is lower, then already applied")
-	skip := flag.Bool("fake", false, "fake do not apply any migration but mark according migrations in migration_services table as completed")
-	check := flag.Bool("check", false, "check verifies if all hashes of migrations are equal to those in migration table. If no - returns list of files with migrations, that have differences. Can accept files or dirs of migrations as arguments")
-	checkApply := flag.Bool("check-apply", false, "check-apply compares hashes of all migrations with hashes in DB and try to apply those, that have differences. Can accept files or dirs of migrations as arguments")
-	applyOnly := flag.Bool("apply-only", false, "apply and shutdown migration service, do not start web service")
-
-	flag.Parse()
-
-	if *init {
+	if *initDB {
 		RunInit(sd, _app)
 		return
 	}
@@ -98,20 +144,34 @@ func RunApp(sd fx.Shutdowner, _app *app.App, c *configurator.Configurator, lc fx
 		RunCheckApply(sd, _app, args, c)
 		return
 	}
+	if *plan {
+		RunPlan(sd, _app, c, *planFormat)
+		return
+	}
+	if *rollback {
+		args := flag.Args()
+		RunRollback(sd, _app, args, c)
+		return
+	}
 	if *finalSql != "" {
 		GetFinalSQL(sd, _app, c, *finalSql)
 		return
 	}
 
-	err := RunMigrations(sd, _app, c)
-	if *applyOnly == false {
-		// Run server
-		RunHttpServer(lc, srv)
-	} else {
-		sd.Shutdown(fx.ExitCode(errorToint(err)))
+	if *applyOnly {
+		err := RunMigrations(sd, _app, c)
+		sd.Shutdown(fx.ExitCode(exitCode(err)))
+		return
 	}
-	// Run server
+
+	// Run server, readiness probe reports ready once migrations are applied
 	RunHttpServer(lc, srv)
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go RunMigrations(sd, _app, c)
+			return nil
+		},
+	})
 }
 
 func RunMigrations(sd fx.Shutdowner, _app *app.App, c *configurator.Configurator) error {
@@ -136,7 +196,34 @@ func GetFinalSQL(sd fx.Shutdowner, _app *app.App, c *configurator.Configurator,
 		log.Error().Err(err).Msg("error during forming sql for migration")
 	}
 	fmt.Println(sql)
-	sd.Shutdown(fx.ExitCode(errorToint(err)))
+	sd.Shutdown(fx.ExitCode(exitCode(err)))
+}
+
+func RunPlan(sd fx.Shutdowner, _app *app.App, c *configurator.Configurator, format string) {
+	cfg := c.New("migration", &app.Config{}, "migration").(*app.Config)
+	log := logger.NewComponentLogger("RunPlan", nil)
+	plan, err := _app.Plan(cfg.Dir)
+	if err != nil {
+		log.Error().Err(err).Msg("error during planning migrations")
+		sd.Shutdown(fx.ExitCode(exitCode(err)))
+		return
+	}
+
+	switch format {
+	case "json":
+		var out []byte
+		out, err = json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			log.Error().Err(err).Msg("cannot encode plan")
+		}
+		fmt.Println(string(out))
+	case "text":
+		fmt.Print(plan.Text())
+	default:
+		err = fmt.Errorf("unknown plan format: %s", format)
+		log.Error().Err(err).Msg("plan format should be text or json")
+	}
+	sd.Shutdown(fx.ExitCode(exitCode(err)))
 }
 
 func RunInit(sd fx.Shutdowner, _app *app.App) {
@@ -146,7 +233,7 @@ func RunInit(sd fx.Shutdowner, _app *app.App) {
 		log.Error().Err(err).Msg("error during creating migration table")
 	}
 	log.Info().Msg("successfully initialized")
-	sd.Shutdown(fx.ExitCode(errorToint(err)))
+	sd.Shutdown(fx.ExitCode(exitCode(err)))
 }
 
 func RunForceApply(sd fx.Shutdowner, _app *app.App, args []string) {
@@ -156,7 +243,7 @@ func RunForceApply(sd fx.Shutdowner, _app *app.App, args []string) {
 		log.Error().Err(err).Msg("error during force apply migrations")
 	}
 	log.Info().Msg("successfully force applied")
-	sd.Shutdown(fx.ExitCode(errorToint(err)))
+	sd.Shutdown(fx.ExitCode(exitCode(err)))
 }
 
 func RunFakeApply(sd fx.Shutdowner, _app *app.App, args []string) {
@@ -166,7 +253,7 @@ func RunFakeApply(sd fx.Shutdowner, _app *app.App, args []string) {
 		log.Error().Err(err).Msg("error during skip migrations")
 	}
 	log.Info().Msg("successfully skipped and marked as finished")
-	sd.Shutdown(fx.ExitCode(errorToint(err)))
+	sd.Shutdown(fx.ExitCode(exitCode(err)))
 }
 
 func RunCheck(sd fx.Shutdowner, _app *app.App, args []string, c *configurator.Configurator) {
@@ -179,7 +266,7 @@ func RunCheck(sd fx.Shutdowner, _app *app.App, args []string, c *configurator.Co
 	if err != nil {
 		log.Error().Err(err).Msg("error during checking migrations")
 	}
-	sd.Shutdown(fx.ExitCode(errorToint(err)))
+	sd.Shutdown(fx.ExitCode(exitCode(err)))
 }
 
 func RunCheckApply(sd fx.Shutdowner, _app *app.App, args []string, c *configurator.Configurator) {
@@ -193,5 +280,52 @@ func RunCheckApply(sd fx.Shutdowner, _app *app.App, args []string, c *configurat
 		log.Error().Err(err).Msg("error during checking and applying migrations")
 	}
 
-	sd.Shutdown(fx.ExitCode(errorToint(err)))
+	sd.Shutdown(fx.ExitCode(exitCode(err)))
+}
+
+func RunRollback(sd fx.Shutdowner, _app *app.App, args []string, c *configurator.Configurator) {
+	cfg := c.New("migration", &app.Config{}, "migration").(*app.Config)
+	log := logger.NewComponentLogger("RunRollback", nil)
+	if len(args) != 2 {
+		log.Error().Msg("rollback requires service name and target version, e.g. --rollback user_users 3")
+		sd.Shutdown(fx.ExitCode(exitUsage))
+		return
+	}
+	targetVersion, err := strconv.Atoi(args[1])
+	if err != nil {
+		log.Error().Err(err).Msgf("target version should be a number: %s", args[1])
+		sd.Shutdown(fx.ExitCode(exitUsage))
+		return
+	}
+
+	_, err = _app.Rollback(context.Background(), cfg.Dir, args[0], targetVersion)
+	if err != nil {
+		log.Error().Err(err).Msg("error during rollback migrations")
+	} else {
+		log.Info().Msg("successfully rolled back")
+	}
+	sd.Shutdown(fx.ExitCode(exitCode(err)))
+}
+
+// RunValidate prints problems of migration dirs and returns exit code, it does not need DB, so it's run without fx app.
+func RunValidate(dirs []string) int {
+	if len(dirs) == 0 {
+		cfg := configurator.NewConfigurator().New("migration", &app.Config{}, "migration").(*app.Config)
+		dirs = append(dirs, cfg.Dir)
+	}
+
+	problems := make([]migration.Problem, 0)
+	for _, dir := range dirs {
+		problems = append(problems, migration.ValidateDir(dir)...)
+	}
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+
+	if migration.HasErrors(problems) {
+		fmt.Printf("%d problems found\n", len(problems))
+		return exitFailed
+	}
+	fmt.Printf("migrations are valid, %d warnings\n", len(problems))
+	return exitOK
 }
@@ -1,2 +0,0 @@
-create view public.users_with_email as
-select * from user_users where email is not null;
\ No newline at end of file
@@ -0,0 +1,2 @@
+create or replace view public.users_with_email as
+select * from user_users where email is not null;
\ No newline at end of file
@@ -0,0 +1,16 @@
+package adapters
+
+import "context"
+
+type fileCtxKey struct{}
+
+// WithFile returns ctx which carries path of the migration file being executed.
+func WithFile(ctx context.Context, path string) context.Context {
+	return context.WithValue(ctx, fileCtxKey{}, path)
+}
+
+// FileFromContext returns path of the migration file set by WithFile, or empty string.
+func FileFromContext(ctx context.Context) string {
+	path, _ := ctx.Value(fileCtxKey{}).(string)
+	return path
+}
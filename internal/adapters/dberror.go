@@ -0,0 +1,49 @@
+package adapters
+
+import "errors"
+
+// Classes of DB errors, errors.Is(err, ErrUndefinedTable) is true for DBError of the class.
+var (
+	ErrUndefinedTable   = errors.New("undefined table")
+	ErrUndefinedColumn  = errors.New("undefined column")
+	ErrLockNotAvailable = errors.New("lock not available")
+	ErrUniqueViolation  = errors.New("unique violation")
+	ErrSyntax           = errors.New("syntax error")
+	ErrSerialization    = errors.New("serialization failure")
+	ErrDeadlock         = errors.New("deadlock detected")
+	ErrQueryCanceled    = errors.New("query canceled")
+)
+
+// DBError is an error reported by DB with its SQLSTATE and class.
+type DBError struct {
+	// Code is SQLSTATE of the error, e.g. 42P01
+	Code string
+	// Class is one of Err* classes, nil for errors which are not classified
+	Class error
+	Err   error
+}
+
+func (e *DBError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DBError) Is(target error) bool {
+	return e.Class != nil && target == e.Class
+}
+
+func (e *DBError) Unwrap() error {
+	return e.Err
+}
+
+// SQLState returns SQLSTATE of DBError or TransientError in the chain of err, or empty string.
+func SQLState(err error) string {
+	var dbErr *DBError
+	if errors.As(err, &dbErr) {
+		return dbErr.Code
+	}
+	var tErr *TransientError
+	if errors.As(err, &tErr) {
+		return tErr.Code
+	}
+	return ""
+}
@@ -2,15 +2,60 @@ package adapters
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/webdevelop-pro/migration-service/internal/domain/migration_log"
 )
 
-type Repository interface {
+// ErrLockTimeout is returned by Lock if the lock is still held by another instance after timeout.
+var ErrLockTimeout = errors.New("timeout waiting for migration lock")
+
+// Tx is a unit of work: migration body and bookkeeping made through it are committed or rolled back together.
+type Tx interface {
+	// Exec executes query, failed query does not abort the unit of work so it can be tolerated by allow_error
+	Exec(ctx context.Context, sql string, arguments ...interface{}) error
+	UpdateServiceVersion(ctx context.Context, name string, ver int) error
+	WriteMigrationServiceLog(ctx context.Context, log migration_log.MigrationServicesLog) error
+	MarkMigrationServiceLogRolledBack(ctx context.Context, log migration_log.MigrationServicesLog) error
+}
+
+// Reader reads bookkeeping tables, it's all dry runs like plan need.
+type Reader interface {
 	GetServiceVersion(ctx context.Context, name string) (int, error)
+	GetHashFromMigrationServiceLog(ctx context.Context, log migration_log.MigrationServicesLog) (string, error)
+}
+
+// ReadOnly is implemented by repositories which create migration tables on first use,
+// its Reader reads missing tables as version 0 and empty hash, so dry runs do not change DB.
+type ReadOnly interface {
+	Reader() Reader
+}
+
+// ReaderOf returns read-only view of repo, repo itself if it does not create tables on first use.
+func ReaderOf(repo Repository) Reader {
+	if ro, ok := repo.(ReadOnly); ok {
+		return ro.Reader()
+	}
+	return repo
+}
+
+type Repository interface {
+	Reader
 	UpdateServiceVersion(ctx context.Context, name string, ver int) error
 	CreateMigrationTable(ctx context.Context) error
 	Exec(ctx context.Context, sql string, arguments ...interface{}) error
+	// ExecNoTx executes statements of sql one by one outside of a transaction, all of them on one connection,
+	// failed statement is reported as StatementError and the following ones are not executed
+	ExecNoTx(ctx context.Context, sql string, arguments ...interface{}) error
 	WriteMigrationServiceLog(ctx context.Context, log migration_log.MigrationServicesLog) error
-	GetHashFromMigrationServiceLog(ctx context.Context, log migration_log.MigrationServicesLog) (string, error)
+	// Ping checks DB connectivity
+	Ping(ctx context.Context) error
+	// TransactionalDDL returns false if DB commits DDL implicitly, so migrations cannot be atomic
+	TransactionalDDL() bool
+	// BeginFunc runs fn as a single unit of work, commits it if fn returns nil and rolls it back otherwise.
+	BeginFunc(ctx context.Context, fn func(tx Tx) error) error
+	// Lock takes cluster-wide migration lock and waits up to timeout if it's held by another instance.
+	// Zero key means key derived from the database and migration table name.
+	Lock(ctx context.Context, key int64, timeout time.Duration) (unlock func(), err error)
 }
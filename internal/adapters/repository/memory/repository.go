@@ -0,0 +1,284 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/webdevelop-pro/go-common/configurator"
+	"github.com/webdevelop-pro/go-common/logger"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration_log"
+)
+
+type Config struct {
+	// Snapshot is a path to JSON file with service versions and logs, see Snapshot
+	Snapshot string
+}
+
+// Snapshot is a JSON representation of bookkeeping tables.
+type Snapshot struct {
+	Versions map[string]int                       `json:"versions"`
+	Logs     []migration_log.MigrationServicesLog `json:"logs,omitempty"`
+}
+
+// Statement is a SQL statement executed by the repository.
+type Statement struct {
+	// File is a path of the migration file, empty for queries which are not part of a migration
+	File string
+	SQL  string
+}
+
+type logKey struct {
+	name     string
+	priority int
+	version  int
+	fileName string
+}
+
+type logRow struct {
+	log        migration_log.MigrationServicesLog
+	rolledBack bool
+}
+
+// Repository keeps bookkeeping in memory and only records executed SQL.
+// It's used by unit tests and for planning against a snapshot without DB connection.
+type Repository struct {
+	mu       sync.Mutex
+	versions map[string]int
+	// logs are append-only rows of migration_service_logs
+	logs     []logRow
+	executed []Statement
+	// fileErrors and statementErrors are injected errors, see FailFile and FailStatement
+	fileErrors      map[string]error
+	statementErrors map[string]error
+	// lock is a buffered channel of size 1, so Lock can wait for it with timeout
+	lock chan struct{}
+}
+
+// New returns new in-memory repository, filled from MEMORY_SNAPSHOT file if it's set.
+func New(c *configurator.Configurator) *Repository {
+	cfg := c.New("memory", &Config{}, "memory").(*Config)
+	r := NewRepository()
+	if cfg.Snapshot != "" {
+		if err := r.LoadFile(cfg.Snapshot); err != nil {
+			l := logger.NewComponentLogger("memory", nil)
+			l.Fatal().Err(err).Msgf("cannot load snapshot %s", cfg.Snapshot)
+		}
+	}
+	return r
+}
+
+// NewRepository returns new empty in-memory repository.
+func NewRepository() *Repository {
+	return &Repository{
+		versions:        make(map[string]int),
+		logs:            make([]logRow, 0),
+		executed:        make([]Statement, 0),
+		fileErrors:      make(map[string]error),
+		statementErrors: make(map[string]error),
+		lock:            make(chan struct{}, 1),
+	}
+}
+
+// LoadFile replaces versions and logs with snapshot from JSON file at path.
+func (r *Repository) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "cannot read %s", path)
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return errors.Wrapf(err, "cannot parse %s", path)
+	}
+	r.Load(snapshot)
+	return nil
+}
+
+// Load replaces versions and logs with snapshot.
+func (r *Repository) Load(snapshot Snapshot) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.versions = make(map[string]int, len(snapshot.Versions))
+	for name, ver := range snapshot.Versions {
+		r.versions[name] = ver
+	}
+	r.logs = make([]logRow, 0, len(snapshot.Logs))
+	for _, log := range snapshot.Logs {
+		r.logs = append(r.logs, logRow{log: log})
+	}
+}
+
+// Snapshot returns current versions and not rolled back logs.
+func (r *Repository) Snapshot() Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := Snapshot{Versions: make(map[string]int, len(r.versions))}
+	for name, ver := range r.versions {
+		snapshot.Versions[name] = ver
+	}
+	for _, row := range r.logs {
+		if !row.rolledBack {
+			snapshot.Logs = append(snapshot.Logs, row.log)
+		}
+	}
+	return snapshot
+}
+
+// Executed returns successfully executed statements in execution order.
+func (r *Repository) Executed() []Statement {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Statement(nil), r.executed...)
+}
+
+// FailFile makes every query of the migration file at path fail with err.
+func (r *Repository) FailFile(path string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.fileErrors[path] = err
+}
+
+// FailStatement makes every statement containing substr fail with err.
+func (r *Repository) FailStatement(substr string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.statementErrors[substr] = err
+}
+
+// TransactionalDDL returns true, failed unit of work leaves no trace.
+func (r *Repository) TransactionalDDL() bool {
+	return true
+}
+
+// GetServiceVersion returns currently deployed version of the service.
+func (r *Repository) GetServiceVersion(ctx context.Context, name string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.versions[name], nil
+}
+
+// UpdateServiceVersion updates service version.
+func (r *Repository) UpdateServiceVersion(ctx context.Context, name string, ver int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.versions[name] = ver
+	return nil
+}
+
+// CreateMigrationTable does nothing, tables always exist in memory.
+func (r *Repository) CreateMigrationTable(ctx context.Context) error {
+	return nil
+}
+
+// Ping always succeeds
+func (r *Repository) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Exec executes query, either all statements of it are recorded or none
+func (r *Repository) Exec(ctx context.Context, sql string, arguments ...interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	statements, err := r.exec(ctx, sql)
+	if err != nil {
+		return err
+	}
+	r.executed = append(r.executed, statements...)
+	return nil
+}
+
+// ExecNoTx executes query, statements before the failed one stay recorded
+func (r *Repository) ExecNoTx(ctx context.Context, sql string, arguments ...interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	statements, err := r.exec(ctx, sql)
+	r.executed = append(r.executed, statements...)
+	return err
+}
+
+// exec returns statements of sql executed before the first injected error.
+// Canceled ctx fails the query like a DB canceling a statement.
+func (r *Repository) exec(ctx context.Context, sql string) ([]Statement, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	file := adapters.FileFromContext(ctx)
+	if err, ok := r.fileErrors[file]; ok && file != "" {
+		return nil, errors.Wrapf(err, "file %s", file)
+	}
+
+	statements := make([]Statement, 0)
+	for i, statement := range migration.ParseStatements(sql) {
+		for substr, err := range r.statementErrors {
+			if strings.Contains(statement.SQL, substr) {
+				return statements, &adapters.StatementError{
+					File:      file,
+					Index:     i + 1,
+					Statement: statement.SQL,
+					Line:      statement.Line,
+					Column:    statement.Column,
+					Err:       err,
+				}
+			}
+		}
+		statements = append(statements, Statement{File: file, SQL: statement.SQL})
+	}
+	return statements, nil
+}
+
+// WriteMigrationServiceLog appends row to migration_service_logs
+func (r *Repository) WriteMigrationServiceLog(ctx context.Context, log migration_log.MigrationServicesLog) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.logs = append(r.logs, logRow{log: log})
+	return nil
+}
+
+// GetHashFromMigrationServiceLog returns hash from the last applied, tolerated or faked row of migration_service_logs
+// which is not rolled back
+func (r *Repository) GetHashFromMigrationServiceLog(ctx context.Context, log migration_log.MigrationServicesLog) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := keyOf(log)
+	for i := len(r.logs) - 1; i >= 0; i-- {
+		row := r.logs[i].log
+		if keyOf(row) == key && migration_log.HasHash(row.Status) && !r.logs[i].rolledBack {
+			return row.Hash, nil
+		}
+	}
+	return "", nil
+}
+
+// Lock takes in-process lock, it's enough since memory is not shared between processes.
+func (r *Repository) Lock(ctx context.Context, key int64, timeout time.Duration) (func(), error) {
+	select {
+	case r.lock <- struct{}{}:
+		return func() { <-r.lock }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(timeout):
+		return nil, errors.Wrapf(adapters.ErrLockTimeout, "timeout %s", timeout)
+	}
+}
+
+func keyOf(log migration_log.MigrationServicesLog) logKey {
+	return logKey{name: log.MigrationServiceName, priority: log.Priority, version: log.Version, fileName: log.FileName}
+}
@@ -0,0 +1,75 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration_log"
+)
+
+// Tx buffers executed statements and bookkeeping changes until BeginFunc commits them.
+type Tx struct {
+	r        *Repository
+	executed []Statement
+	// changes are applied to the repository on commit, in order
+	changes []func()
+}
+
+// BeginFunc runs fn, commits buffered changes if fn returns nil and drops them otherwise.
+func (r *Repository) BeginFunc(ctx context.Context, fn func(tx adapters.Tx) error) error {
+	t := &Tx{r: r}
+	if err := fn(t); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.executed = append(r.executed, t.executed...)
+	for _, change := range t.changes {
+		change()
+	}
+	return nil
+}
+
+// Exec executes query, failed query leaves no statements recorded, like a savepoint.
+func (t *Tx) Exec(ctx context.Context, sql string, arguments ...interface{}) error {
+	t.r.mu.Lock()
+	defer t.r.mu.Unlock()
+
+	statements, err := t.r.exec(ctx, sql)
+	if err != nil {
+		return err
+	}
+	t.executed = append(t.executed, statements...)
+	return nil
+}
+
+// UpdateServiceVersion updates service version on commit.
+func (t *Tx) UpdateServiceVersion(ctx context.Context, name string, ver int) error {
+	t.changes = append(t.changes, func() {
+		t.r.versions[name] = ver
+	})
+	return nil
+}
+
+// WriteMigrationServiceLog appends row to migration_service_logs on commit.
+func (t *Tx) WriteMigrationServiceLog(ctx context.Context, log migration_log.MigrationServicesLog) error {
+	t.changes = append(t.changes, func() {
+		t.r.logs = append(t.r.logs, logRow{log: log})
+	})
+	return nil
+}
+
+// MarkMigrationServiceLogRolledBack marks rows of the migration as rolled back on commit.
+func (t *Tx) MarkMigrationServiceLogRolledBack(ctx context.Context, log migration_log.MigrationServicesLog) error {
+	t.changes = append(t.changes, func() {
+		for i, row := range t.r.logs {
+			if row.log.MigrationServiceName == log.MigrationServiceName && row.log.Version == log.Version && row.log.FileName == log.FileName &&
+				row.log.Priority == log.Priority {
+				t.r.logs[i].rolledBack = true
+			}
+		}
+	})
+	return nil
+}
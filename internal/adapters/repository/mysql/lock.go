@@ -0,0 +1,101 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+)
+
+const (
+	// lockTable is used together with database name to derive lock name
+	lockTable = "migration_services"
+	// lockRetryInterval is how often we retry GET_LOCK while lock is held by another instance
+	lockRetryInterval = time.Second
+)
+
+type lockHolder struct {
+	id   int64
+	user string
+	host string
+}
+
+// Lock takes named GET_LOCK lock on a dedicated connection.
+// Connection is kept until unlock is called, so lock lives exactly as long as we need it.
+func (r *Repository) Lock(ctx context.Context, key int64, timeout time.Duration) (func(), error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot acquire connection for migration lock")
+	}
+
+	var name string
+	if key == 0 {
+		const query = `SELECT CONCAT(DATABASE(), '.', ?)`
+		if err := conn.QueryRowContext(ctx, query, lockTable).Scan(&name); err != nil {
+			_ = conn.Close()
+			return nil, errors.Wrapf(err, "query %s failed", query)
+		}
+	} else {
+		name = fmt.Sprintf("%s.%d", lockTable, key)
+	}
+
+	deadline := time.Now().Add(timeout)
+	var lastHolder int64 = -1
+	for {
+		var locked sql.NullInt64
+		if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, 0)`, name).Scan(&locked); err != nil {
+			_ = conn.Close()
+			return nil, errors.Wrapf(err, "cannot take migration lock %s", name)
+		}
+		if locked.Valid && locked.Int64 == 1 {
+			break
+		}
+
+		holder, err := r.lockHolder(ctx, name)
+		if err != nil {
+			r.log.Warn().Err(err).Msgf("cannot get holder of migration lock %s", name)
+		} else if holder.id != lastHolder {
+			r.log.Warn().Msgf(
+				"migration lock %s is held by connection %d, user %s, host %s; waiting",
+				name, holder.id, holder.user, holder.host,
+			)
+			lastHolder = holder.id
+		}
+
+		if time.Now().After(deadline) {
+			_ = conn.Close()
+			return nil, errors.Wrapf(adapters.ErrLockTimeout, "lock %s, timeout %s", name, timeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+
+	r.log.Debug().Msgf("took migration lock %s", name)
+
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(?)`, name); err != nil {
+			r.log.Error().Err(err).Msgf("cannot release migration lock %s", name)
+		}
+		_ = conn.Close()
+	}, nil
+}
+
+// lockHolder returns connection which currently holds the named lock.
+func (r *Repository) lockHolder(ctx context.Context, name string) (lockHolder, error) {
+	const query = `SELECT id, user, host FROM information_schema.processlist WHERE id = IS_USED_LOCK(?)`
+
+	var holder lockHolder
+	err := r.db.QueryRowContext(ctx, query, name).Scan(&holder.id, &holder.user, &holder.host)
+	if err != nil {
+		return holder, errors.Wrapf(err, "query %s failed", query)
+	}
+	return holder, nil
+}
@@ -0,0 +1,312 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"github.com/webdevelop-pro/go-common/configurator"
+	"github.com/webdevelop-pro/go-common/logger"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration_log"
+)
+
+// MySQL error numbers, https://dev.mysql.com/doc/mysql-errors/8.0/en/server-error-reference.html
+const (
+	noTableErrNumber      = 1146 // ER_NO_SUCH_TABLE
+	noColumnErrNumber     = 1054 // ER_BAD_FIELD_ERROR
+	noSavepointErrNumber  = 1305 // ER_SP_DOES_NOT_EXIST, savepoints are gone after implicit commit
+	lockWaitErrNumber     = 1205 // ER_LOCK_WAIT_TIMEOUT
+	queryTimeoutErrNumber = 3024 // ER_QUERY_TIMEOUT, max_execution_time exceeded
+)
+
+const (
+	// VALUES() is deprecated in MySQL 8.0.20+, but row alias syntax is not supported by MariaDB
+	updateServiceVersionQuery     = `INSERT INTO migration_services (name, version) VALUES (?, ?) ON DUPLICATE KEY UPDATE version=VALUES(version)`
+	writeMigrationServiceLogQuery = "INSERT INTO migration_service_logs (migration_services_name, priority, version, file_name, `sql`, hash, " +
+		"status, error, `sqlstate`, attempt, started_at, finished_at, duration_ms, env_name, host, binary_version, git_commit) " +
+		"VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''))"
+	markRolledBackQuery = `UPDATE migration_service_logs SET rolled_back_at=NOW()
+		WHERE migration_services_name = ? AND version = ? AND file_name = ? AND priority = ?`
+)
+
+// Config uses the same DB_* variables as postgres connection.
+type Config struct {
+	Host     string `default:"localhost"`
+	Port     int    `default:"3306"`
+	User     string `required:"true"`
+	Password string
+	Database string `required:"true"`
+}
+
+type Repository struct {
+	db  *sql.DB
+	log logger.Logger
+	// tablesMu guards tablesReady, see ensureMigrationTable
+	tablesMu    sync.Mutex
+	tablesReady bool
+}
+
+// New returns new MySQL repository for DB_* database.
+func New(c *configurator.Configurator) *Repository {
+	cfg := c.New("mysql", &Config{}, "db").(*Config)
+
+	dsn := mysql.NewConfig()
+	dsn.Net = "tcp"
+	dsn.Addr = net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	dsn.User = cfg.User
+	dsn.Passwd = cfg.Password
+	dsn.DBName = cfg.Database
+	// migration files usually have several statements
+	dsn.MultiStatements = true
+	dsn.ParseTime = true
+
+	r, err := Open(dsn.FormatDSN())
+	if err != nil {
+		l := logger.NewComponentLogger("mysql", nil)
+		l.Fatal().Err(err).Msgf("cannot open mysql database %s", cfg.Database)
+	}
+	return r
+}
+
+// Open returns new MySQL repository for dsn, dsn should have multiStatements=true to run migration files.
+func Open(dsn string) (*Repository, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot open mysql connection")
+	}
+
+	return &Repository{
+		db:  db,
+		log: logger.NewComponentLogger("mysql", nil),
+	}, nil
+}
+
+// TransactionalDDL returns false: MySQL commits implicitly before and after every DDL statement.
+func (r *Repository) TransactionalDDL() bool {
+	return false
+}
+
+// UpdateServiceVersion updates service version.
+func (r *Repository) UpdateServiceVersion(ctx context.Context, name string, ver int) error {
+	const query = updateServiceVersionQuery
+	_, err := r.db.ExecContext(ctx, query, name, ver)
+
+	if err != nil {
+		return errors.Wrapf(err, "query %s failed, params: %s %d", query, name, ver)
+	}
+	return nil
+}
+
+// GetServiceVersion returns currently deployed version of the service.
+// Missing migration tables are created and the query is retried once.
+func (r *Repository) GetServiceVersion(ctx context.Context, name string) (int, error) {
+	ver, err := r.serviceVersion(ctx, name)
+	if isNoTableErr(err) {
+		if err := r.CreateMigrationTable(ctx); err != nil {
+			return 0, err
+		}
+		ver, err = r.serviceVersion(ctx, name)
+	}
+	return ver, err
+}
+
+// reader reads migration tables without creating or upgrading them.
+type reader struct {
+	r *Repository
+}
+
+// Reader returns read-only view of the repository used by dry runs.
+func (r *Repository) Reader() adapters.Reader {
+	return reader{r: r}
+}
+
+// GetServiceVersion returns version of the service, 0 if migration tables are missing.
+func (rd reader) GetServiceVersion(ctx context.Context, name string) (int, error) {
+	ver, err := rd.r.serviceVersion(ctx, name)
+	if isNoTableErr(err) {
+		return 0, nil
+	}
+	return ver, err
+}
+
+// serviceVersion returns version of the service from migration_services, 0 if there is no row.
+func (r *Repository) serviceVersion(ctx context.Context, name string) (int, error) {
+	const query = `SELECT version FROM migration_services WHERE name=?`
+
+	var ver int
+	err := r.db.QueryRowContext(ctx, query, name).Scan(&ver)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, errors.Wrapf(err, "query %s failed, %s ", query, name)
+	}
+
+	return ver, nil
+}
+
+// Ping checks DB connectivity
+func (r *Repository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// Exec executes query in a transaction, DDL statements are committed implicitly anyway
+func (r *Repository) Exec(ctx context.Context, sql string, arguments ...interface{}) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, sql, arguments...); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ExecNoTx executes statements of query one by one outside of a transaction on one connection,
+// timeouts of ctx are set for the session of the query and reset after it.
+func (r *Repository) ExecNoTx(ctx context.Context, sql string, arguments ...interface{}) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	reset, err := setTimeouts(ctx, conn, adapters.TimeoutsFromContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer reset()
+
+	if len(arguments) > 0 {
+		_, err = conn.ExecContext(ctx, sql, arguments...)
+		return timeoutError(ctx, err)
+	}
+	for i, statement := range migration.ParseStatements(sql) {
+		if _, err := conn.ExecContext(ctx, statement.SQL); err != nil {
+			return &adapters.StatementError{
+				File:      adapters.FileFromContext(ctx),
+				Index:     i + 1,
+				Statement: statement.SQL,
+				Line:      statement.Line,
+				Column:    statement.Column,
+				Err:       timeoutError(ctx, err),
+			}
+		}
+	}
+	return nil
+}
+
+// ensureMigrationTable creates or upgrades migration tables once per repository.
+// Unlike postgres we cannot create them after failed unit of work and run it again:
+// DDL of the migration is already committed implicitly, so tables have to exist before.
+func (r *Repository) ensureMigrationTable(ctx context.Context) error {
+	r.tablesMu.Lock()
+	ready := r.tablesReady
+	r.tablesMu.Unlock()
+	if ready {
+		return nil
+	}
+	return r.CreateMigrationTable(ctx)
+}
+
+// WriteMigrationServiceLog inserts row to migration_service_logs.
+// Missing migration tables are created and the query is retried once.
+func (r *Repository) WriteMigrationServiceLog(ctx context.Context, log migration_log.MigrationServicesLog) error {
+	err := r.writeLog(ctx, log)
+	if isNoTableErr(err) {
+		if err := r.CreateMigrationTable(ctx); err != nil {
+			return err
+		}
+		err = r.writeLog(ctx, log)
+	}
+	return err
+}
+
+func (r *Repository) writeLog(ctx context.Context, log migration_log.MigrationServicesLog) error {
+	const query = writeMigrationServiceLogQuery
+	_, err := r.db.ExecContext(ctx, query, logArgs(log)...)
+
+	if err != nil {
+		return errors.Wrapf(err, "query %s failed, params: MigrationServiceName = %s, Priority = %d, "+
+			"Version = %d, FileName = %s, SQL = %s, Hash = %s", query, log.MigrationServiceName, log.Priority,
+			log.Version, log.FileName, log.SQL, log.Hash)
+	}
+	return nil
+}
+
+// GetHashFromMigrationServiceLog returns hash of the last applied, tolerated or faked row of the migration from migration_service_logs.
+// Missing migration tables are created and the query is retried once.
+func (r *Repository) GetHashFromMigrationServiceLog(ctx context.Context, log migration_log.MigrationServicesLog) (string, error) {
+	hash, err := r.logHash(ctx, log)
+	if isNoTableErr(err) {
+		if err := r.CreateMigrationTable(ctx); err != nil {
+			return "", err
+		}
+		hash, err = r.logHash(ctx, log)
+	}
+	return hash, err
+}
+
+// GetHashFromMigrationServiceLog returns hash of the last applied row of the migration,
+// empty if migration tables or their columns are missing.
+func (rd reader) GetHashFromMigrationServiceLog(ctx context.Context, log migration_log.MigrationServicesLog) (string, error) {
+	hash, err := rd.r.logHash(ctx, log)
+	if isNoTableErr(err) {
+		return "", nil
+	}
+	return hash, err
+}
+
+// logHash returns hash of the last applied, tolerated or faked row of the migration which is not rolled back,
+// empty if there is no row.
+func (r *Repository) logHash(ctx context.Context, log migration_log.MigrationServicesLog) (string, error) {
+	var hash string
+	const query = `SELECT hash FROM migration_service_logs
+    	WHERE migration_services_name = ? AND priority = ? AND version = ? AND file_name = ?
+    	AND status IN ('applied', 'tolerated', 'faked') AND rolled_back_at IS NULL ORDER BY id DESC LIMIT 1`
+	err := r.db.QueryRowContext(ctx, query, log.MigrationServiceName, log.Priority, log.Version, log.FileName).Scan(&hash)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "query %s failed, params: MigrationServiceName = %s, Priority = %d, "+
+			"Version = %d, FileName = %s", query, log.MigrationServiceName, log.Priority,
+			log.Version, log.FileName)
+	}
+	return hash, nil
+}
+
+// isNoTableErr returns true if query failed because of a missing table or column
+func isNoTableErr(err error) bool {
+	return hasErrNumber(err, noTableErrNumber) || hasErrNumber(err, noColumnErrNumber)
+}
+
+func hasErrNumber(err error, number uint16) bool {
+	var myErr *mysql.MySQLError
+	return errors.As(err, &myErr) && myErr.Number == number
+}
+
+// logArgs returns arguments of writeMigrationServiceLogQuery, zero times are written as NULL.
+func logArgs(log migration_log.MigrationServicesLog) []interface{} {
+	var startedAt, finishedAt *time.Time
+	if !log.StartedAt.IsZero() {
+		startedAt = &log.StartedAt
+	}
+	if !log.FinishedAt.IsZero() {
+		finishedAt = &log.FinishedAt
+	}
+	return []interface{}{
+		log.MigrationServiceName, log.Priority, log.Version, log.FileName, log.SQL, log.Hash,
+		log.Status, log.Error, log.SQLState, log.Attempt, startedAt, finishedAt, log.Duration.Milliseconds(),
+		log.EnvName, log.Host, log.BinaryVersion, log.GitCommit,
+	}
+}
@@ -0,0 +1,243 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+)
+
+const (
+	// metaTable keeps the single row with version of bookkeeping tables, it's also used to derive upgrade lock name
+	metaTable = "migration_service_meta"
+	// upgradeLockTimeout is how many seconds to wait for another instance upgrading bookkeeping tables
+	upgradeLockTimeout = 60
+)
+
+// schemaStep upgrades bookkeeping tables from version-1 to version.
+type schemaStep struct {
+	version     int
+	description string
+	up          func(ctx context.Context, conn *sql.Conn) error
+}
+
+// schemaSteps are executed in order, each one once. Never edit a released step, append a new one.
+// MySQL commits DDL implicitly, so every step has to be safe to run again if it failed in the middle.
+var schemaSteps = []schemaStep{
+	{version: 1, description: "create migration_services and migration_service_logs", up: execQuery(createTablesQuery)},
+	{version: 2, description: "upgrade migration_service_logs created by unversioned releases", up: upgradeUnversioned},
+}
+
+const createTablesQuery = "CREATE TABLE IF NOT EXISTS migration_services (\n" +
+	"	id int NOT NULL AUTO_INCREMENT PRIMARY KEY,\n" +
+	"	name varchar(255) NOT NULL UNIQUE,\n" +
+	"	version int NOT NULL DEFAULT 0,\n" +
+	"	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,\n" +
+	"	updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP\n" +
+	");\n" +
+	"\n" +
+	"CREATE TABLE IF NOT EXISTS migration_service_logs\n" +
+	"(\n" +
+	"    id                      int          NOT NULL AUTO_INCREMENT PRIMARY KEY,\n" +
+	"\n" +
+	"    -- required\n" +
+	"    migration_services_name varchar(255) NOT NULL,\n" +
+	"    priority                int          NOT NULL,\n" +
+	"    version                 int          NOT NULL,\n" +
+	"    file_name               varchar(255) NOT NULL,\n" +
+	"    `sql`                   longtext     NOT NULL,\n" +
+	"    hash                    varchar(255) NOT NULL,\n" +
+	"    status                  varchar(32)  NOT NULL DEFAULT 'applied',\n" +
+	"    error                   text         NULL,\n" +
+	"    `sqlstate`              varchar(5)   NULL,\n" +
+	"    attempt                 int          NOT NULL DEFAULT 1,\n" +
+	"    started_at              datetime(6)  NULL,\n" +
+	"    finished_at             datetime(6)  NULL,\n" +
+	"    duration_ms             bigint       NULL,\n" +
+	"\n" +
+	"    -- executor\n" +
+	"    env_name                varchar(255) NULL,\n" +
+	"    host                    varchar(255) NULL,\n" +
+	"    binary_version          varchar(255) NULL,\n" +
+	"    git_commit              varchar(64)  NULL,\n" +
+	"\n" +
+	"    -- dates\n" +
+	"    created_at              timestamp    NOT NULL DEFAULT CURRENT_TIMESTAMP,\n" +
+	"    updated_at              timestamp    NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,\n" +
+	"    rolled_back_at          timestamp    NULL DEFAULT NULL,\n" +
+	"\n" +
+	"    KEY migration_service_logs_migration_index (migration_services_name, priority, version, file_name),\n" +
+	"    KEY migration_service_logs_hash_index (hash)\n" +
+	");\n"
+
+// CreateMigrationTable creates bookkeeping tables or upgrades them to the latest schemaSteps version.
+// Steps are executed under GET_LOCK, so concurrent instances do not run them twice, and version is
+// bumped after every step. Returns SchemaVersionError if tables are newer than the binary.
+func (r *Repository) CreateMigrationTable(ctx context.Context) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "cannot acquire connection for bookkeeping schema upgrade")
+	}
+	defer conn.Close()
+
+	const lockQuery = `SELECT GET_LOCK(CONCAT(DATABASE(), '.', ?), ?)`
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, lockQuery, metaTable, upgradeLockTimeout).Scan(&locked); err != nil {
+		return errors.Wrapf(err, "query %s failed", lockQuery)
+	}
+	if !locked.Valid || locked.Int64 != 1 {
+		return errors.Wrapf(adapters.ErrLockTimeout, "bookkeeping schema upgrade lock, timeout %ds", upgradeLockTimeout)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(CONCAT(DATABASE(), '.', ?))`, metaTable); err != nil {
+			r.log.Error().Err(err).Msg("cannot release bookkeeping schema upgrade lock")
+		}
+	}()
+
+	if err := r.upgradeSchema(ctx, conn); err != nil {
+		return err
+	}
+
+	r.tablesMu.Lock()
+	r.tablesReady = true
+	r.tablesMu.Unlock()
+
+	return nil
+}
+
+func (r *Repository) upgradeSchema(ctx context.Context, conn *sql.Conn) error {
+	const metaQuery = "CREATE TABLE IF NOT EXISTS migration_service_meta\n" +
+		"(\n" +
+		"    id             int       NOT NULL DEFAULT 1 PRIMARY KEY,\n" +
+		"    schema_version int       NOT NULL DEFAULT 0,\n" +
+		"    updated_at     timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP\n" +
+		");\n" +
+		"INSERT IGNORE INTO migration_service_meta (id) VALUES (1);\n"
+	if _, err := conn.ExecContext(ctx, metaQuery); err != nil {
+		return errors.Wrapf(err, "query %s failed", metaQuery)
+	}
+
+	const versionQuery = `SELECT schema_version FROM migration_service_meta WHERE id = 1`
+	var version int
+	if err := conn.QueryRowContext(ctx, versionQuery).Scan(&version); err != nil {
+		return errors.Wrapf(err, "query %s failed", versionQuery)
+	}
+	known := schemaSteps[len(schemaSteps)-1].version
+	if err := adapters.CheckSchemaVersion(version, known); err != nil {
+		return err
+	}
+
+	// tables may be dropped after they were upgraded, the first step is idempotent,
+	// so it's executed every time to create them again
+	if version >= schemaSteps[0].version {
+		if err := schemaSteps[0].up(ctx, conn); err != nil {
+			return errors.Wrapf(err, "cannot create bookkeeping tables: %s", schemaSteps[0].description)
+		}
+	}
+	for _, step := range schemaSteps {
+		if step.version <= version {
+			continue
+		}
+		if err := step.up(ctx, conn); err != nil {
+			return errors.Wrapf(err, "bookkeeping schema upgrade to version %d failed: %s", step.version, step.description)
+		}
+
+		const updateQuery = `UPDATE migration_service_meta SET schema_version = ? WHERE id = 1`
+		if _, err := conn.ExecContext(ctx, updateQuery, step.version); err != nil {
+			return errors.Wrapf(err, "query %s failed", updateQuery)
+		}
+		r.log.Info().Msgf("upgraded bookkeeping schema to version %d: %s", step.version, step.description)
+	}
+	return nil
+}
+
+// execQuery returns step which executes query.
+func execQuery(query string) func(ctx context.Context, conn *sql.Conn) error {
+	return func(ctx context.Context, conn *sql.Conn) error {
+		if _, err := conn.ExecContext(ctx, query); err != nil {
+			return errors.Wrapf(err, "query %s failed", query)
+		}
+		return nil
+	}
+}
+
+// logColumns are columns added to migration_service_logs by unversioned releases,
+// MySQL does not have ADD COLUMN IF NOT EXISTS.
+var logColumns = []struct {
+	name       string
+	definition string
+}{
+	{"status", "varchar(32) NOT NULL DEFAULT 'applied'"},
+	{"error", "text NULL"},
+	{"attempt", "int NOT NULL DEFAULT 1"},
+	{"sqlstate", "varchar(5) NULL"},
+	{"started_at", "datetime(6) NULL"},
+	{"finished_at", "datetime(6) NULL"},
+	{"duration_ms", "bigint NULL"},
+	{"env_name", "varchar(255) NULL"},
+	{"host", "varchar(255) NULL"},
+	{"binary_version", "varchar(255) NULL"},
+	{"git_commit", "varchar(64) NULL"},
+}
+
+// upgradeUnversioned adds missing logColumns and replaces the unique key of migration_service_logs
+// with a plain index, every attempt is a row now.
+func upgradeUnversioned(ctx context.Context, conn *sql.Conn) error {
+	if err := addLogColumns(ctx, conn); err != nil {
+		return err
+	}
+
+	const query = `SELECT count(*) FROM information_schema.statistics
+		WHERE table_schema = DATABASE() AND table_name = 'migration_service_logs' AND index_name = 'migration_service_logs_complex_uindex'`
+	var n int
+	if err := conn.QueryRowContext(ctx, query).Scan(&n); err != nil {
+		return errors.Wrapf(err, "query %s failed", query)
+	}
+	if n == 0 {
+		return nil
+	}
+
+	const alter = `ALTER TABLE migration_service_logs DROP INDEX migration_service_logs_complex_uindex,
+		ADD INDEX migration_service_logs_migration_index (migration_services_name, priority, version, file_name)`
+	if _, err := conn.ExecContext(ctx, alter); err != nil {
+		return errors.Wrapf(err, "query %s failed", alter)
+	}
+	return nil
+}
+
+// addLogColumns adds logColumns missing in migration_service_logs.
+func addLogColumns(ctx context.Context, conn *sql.Conn) error {
+	const query = `SELECT column_name FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = 'migration_service_logs'`
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return errors.Wrapf(err, "query %s failed", query)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return errors.Wrapf(err, "query %s failed", query)
+		}
+		existing[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrapf(err, "query %s failed", query)
+	}
+	rows.Close()
+
+	for _, column := range logColumns {
+		if existing[column.name] {
+			continue
+		}
+		// sqlstate is a reserved word
+		alter := "ALTER TABLE migration_service_logs ADD COLUMN `" + column.name + "` " + column.definition
+		if _, err := conn.ExecContext(ctx, alter); err != nil {
+			return errors.Wrapf(err, "query %s failed", alter)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+)
+
+// setTimeouts sets not zero timeouts for the session of conn and returns func which resets them.
+// MySQL max_execution_time limits only read-only SELECT statements, DDL is limited by context deadline.
+func setTimeouts(ctx context.Context, conn *sql.Conn, timeouts adapters.Timeouts) (func(), error) {
+	settings := make([]string, 0, 3)
+	if timeouts.Statement > 0 {
+		settings = append(settings, fmt.Sprintf("max_execution_time = %d", ceil(timeouts.Statement, time.Millisecond)))
+	}
+	if timeouts.Lock > 0 {
+		seconds := ceil(timeouts.Lock, time.Second)
+		settings = append(settings,
+			fmt.Sprintf("innodb_lock_wait_timeout = %d", seconds),
+			fmt.Sprintf("lock_wait_timeout = %d", seconds),
+		)
+	}
+	if len(settings) == 0 {
+		return func() {}, nil
+	}
+
+	query := "SET SESSION " + strings.Join(settings, ", ")
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		return nil, errors.Wrapf(err, "query %s failed", query)
+	}
+
+	return func() {
+		for i, setting := range settings {
+			settings[i] = setting[:strings.Index(setting, " =")] + " = DEFAULT"
+		}
+		if _, err := conn.ExecContext(context.Background(), "SET SESSION "+strings.Join(settings, ", ")); err != nil {
+			// connection with unknown session settings should not go back to the pool
+			_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+	}, nil
+}
+
+// ceil returns d in units, at least 1 since zero disables the timeout.
+func ceil(d, unit time.Duration) int64 {
+	n := int64((d + unit - 1) / unit)
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// timeoutError returns adapters.TimeoutError if query was canceled by timeouts of ctx.
+func timeoutError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	timeouts := adapters.TimeoutsFromContext(ctx)
+	switch {
+	case timeouts.Statement > 0 && hasErrNumber(err, queryTimeoutErrNumber):
+		return &adapters.TimeoutError{Setting: "statement_timeout", Timeout: timeouts.Statement, Err: err}
+	case timeouts.Lock > 0 && hasErrNumber(err, lockWaitErrNumber):
+		return &adapters.TimeoutError{Setting: "lock_timeout", Timeout: timeouts.Lock, Err: err}
+	}
+	return err
+}
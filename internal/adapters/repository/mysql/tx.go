@@ -0,0 +1,100 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration_log"
+)
+
+// Tx runs migration and bookkeeping queries inside of the transaction started by BeginFunc.
+// MySQL commits implicitly on DDL, so only DML of the migration and bookkeeping are really atomic.
+type Tx struct {
+	tx *sql.Tx
+}
+
+// BeginFunc runs fn in a transaction, commits it if fn returns nil and rolls it back otherwise.
+// Timeouts of ctx are set for the session of the transaction and reset after it.
+func (r *Repository) BeginFunc(ctx context.Context, fn func(tx adapters.Tx) error) error {
+	if err := r.ensureMigrationTable(ctx); err != nil {
+		return err
+	}
+
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	reset, err := setTimeouts(ctx, conn, adapters.TimeoutsFromContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer reset()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(&Tx{tx: tx}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Exec executes query in a savepoint, so failed query does not abort the whole transaction.
+// Implicit commit of DDL removes the savepoint, it's not an error.
+func (t *Tx) Exec(ctx context.Context, sql string, arguments ...interface{}) error {
+	if _, err := t.tx.ExecContext(ctx, "SAVEPOINT migration"); err != nil {
+		return err
+	}
+	if _, err := t.tx.ExecContext(ctx, sql, arguments...); err != nil {
+		if _, rErr := t.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT migration"); rErr != nil && !hasErrNumber(rErr, noSavepointErrNumber) {
+			return errors.Wrap(rErr, err.Error())
+		}
+		return timeoutError(ctx, err)
+	}
+	if _, err := t.tx.ExecContext(ctx, "RELEASE SAVEPOINT migration"); err != nil && !hasErrNumber(err, noSavepointErrNumber) {
+		return err
+	}
+	return nil
+}
+
+// UpdateServiceVersion updates service version.
+func (t *Tx) UpdateServiceVersion(ctx context.Context, name string, ver int) error {
+	const query = updateServiceVersionQuery
+	_, err := t.tx.ExecContext(ctx, query, name, ver)
+
+	if err != nil {
+		return errors.Wrapf(err, "query %s failed, params: %s %d", query, name, ver)
+	}
+	return nil
+}
+
+// WriteMigrationServiceLog inserts row to migration_service_logs
+func (t *Tx) WriteMigrationServiceLog(ctx context.Context, log migration_log.MigrationServicesLog) error {
+	const query = writeMigrationServiceLogQuery
+	_, err := t.tx.ExecContext(ctx, query, logArgs(log)...)
+
+	if err != nil {
+		return errors.Wrapf(err, "query %s failed, params: MigrationServiceName = %s, Priority = %d, "+
+			"Version = %d, FileName = %s, SQL = %s, Hash = %s", query, log.MigrationServiceName, log.Priority,
+			log.Version, log.FileName, log.SQL, log.Hash)
+	}
+	return nil
+}
+
+// MarkMigrationServiceLogRolledBack marks migration_service_logs rows of the migration as rolled back
+func (t *Tx) MarkMigrationServiceLogRolledBack(ctx context.Context, log migration_log.MigrationServicesLog) error {
+	const query = markRolledBackQuery
+	_, err := t.tx.ExecContext(ctx, query, log.MigrationServiceName, log.Version, log.FileName, log.Priority)
+
+	if err != nil {
+		return errors.Wrapf(err, "query %s failed, params: MigrationServiceName = %s, Version = %d, FileName = %s, Priority = %d",
+			query, log.MigrationServiceName, log.Version, log.FileName, log.Priority)
+	}
+	return nil
+}
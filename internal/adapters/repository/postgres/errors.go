@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+)
+
+const NO_TABLE_CODE = "42P01"
+const NO_COLUMN_CODE = "42703"
+const QUERY_CANCELED_CODE = "57014"
+const LOCK_NOT_AVAILABLE_CODE = "55P03"
+const SERIALIZATION_FAILURE_CODE = "40001"
+const DEADLOCK_DETECTED_CODE = "40P01"
+const UNIQUE_VIOLATION_CODE = "23505"
+const SYNTAX_ERROR_CODE = "42601"
+
+// errorClasses are classes of SQLSTATEs migration logic branches on.
+var errorClasses = map[string]error{
+	NO_TABLE_CODE:              adapters.ErrUndefinedTable,
+	NO_COLUMN_CODE:             adapters.ErrUndefinedColumn,
+	QUERY_CANCELED_CODE:        adapters.ErrQueryCanceled,
+	LOCK_NOT_AVAILABLE_CODE:    adapters.ErrLockNotAvailable,
+	SERIALIZATION_FAILURE_CODE: adapters.ErrSerialization,
+	DEADLOCK_DETECTED_CODE:     adapters.ErrDeadlock,
+	UNIQUE_VIOLATION_CODE:      adapters.ErrUniqueViolation,
+	SYNTAX_ERROR_CODE:          adapters.ErrSyntax,
+}
+
+// pgCode returns SQLSTATE of *pgconn.PgError in the chain of err, or empty string.
+func pgCode(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
+
+// classify wraps postgres error to adapters.DBError with its SQLSTATE and class.
+func classify(err error) error {
+	var dbErr *adapters.DBError
+	if err == nil || errors.As(err, &dbErr) {
+		return err
+	}
+	code := pgCode(err)
+	if code == "" {
+		return err
+	}
+	return &adapters.DBError{Code: code, Class: errorClasses[code], Err: err}
+}
+
+// isNoColumnErr returns true if query failed because of a missing column
+func isNoColumnErr(err error) bool {
+	return pgCode(err) == NO_COLUMN_CODE
+}
+
+// isNoTableErr returns true if query failed because of a missing table
+func isNoTableErr(err error) bool {
+	return pgCode(err) == NO_TABLE_CODE
+}
@@ -0,0 +1,103 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+)
+
+const (
+	// lockTable is used together with database name to derive advisory lock key
+	lockTable = "migration_services"
+	// lockRetryInterval is how often we retry pg_try_advisory_lock while lock is held by another instance
+	lockRetryInterval = time.Second
+)
+
+type lockHolder struct {
+	pid          int
+	appName      string
+	clientAddr   string
+	backendStart time.Time
+}
+
+// Lock takes session-level pg_advisory_lock on a dedicated connection.
+// Connection is kept until unlock is called, so lock lives exactly as long as we need it.
+func (r *Repository) Lock(ctx context.Context, key int64, timeout time.Duration) (func(), error) {
+	conn, err := r.db.Acquire(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot acquire connection for migration lock")
+	}
+
+	if key == 0 {
+		const query = `SELECT hashtextextended(current_database() || '.' || $1, 0)`
+		if err := conn.QueryRow(ctx, query, lockTable).Scan(&key); err != nil {
+			conn.Release()
+			return nil, errors.Wrapf(err, "query %s failed", query)
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+	lastHolder := -1
+	for {
+		var locked bool
+		if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&locked); err != nil {
+			conn.Release()
+			return nil, errors.Wrapf(err, "cannot take migration lock %d", key)
+		}
+		if locked {
+			break
+		}
+
+		holder, err := r.lockHolder(ctx, key)
+		if err != nil {
+			r.log.Warn().Err(err).Msgf("cannot get holder of migration lock %d", key)
+		} else if holder.pid != lastHolder {
+			r.log.Warn().Msgf(
+				"migration lock %d is held by pid %d, application %s, client %s, connected at %s; waiting",
+				key, holder.pid, holder.appName, holder.clientAddr, holder.backendStart.Format(time.RFC3339),
+			)
+			lastHolder = holder.pid
+		}
+
+		if time.Now().After(deadline) {
+			conn.Release()
+			return nil, errors.Wrapf(adapters.ErrLockTimeout, "lock %d, timeout %s", key, timeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			conn.Release()
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+
+	r.log.Debug().Msgf("took migration lock %d", key)
+
+	return func() {
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, key); err != nil {
+			r.log.Error().Err(err).Msgf("cannot release migration lock %d", key)
+		}
+		conn.Release()
+	}, nil
+}
+
+// lockHolder returns backend which currently holds advisory lock with the key.
+func (r *Repository) lockHolder(ctx context.Context, key int64) (lockHolder, error) {
+	// bigint advisory lock key is stored in pg_locks as classid (high 32 bits) and objid (low 32 bits)
+	const query = `SELECT a.pid, coalesce(a.application_name, ''), coalesce(host(a.client_addr), ''), a.backend_start
+	FROM pg_locks l JOIN pg_stat_activity a ON a.pid = l.pid
+	WHERE l.locktype = 'advisory' AND l.granted AND l.objsubid = 1
+		AND l.classid = (($1::bigint >> 32) & 4294967295)::oid
+		AND l.objid = ($1::bigint & 4294967295)::oid
+	LIMIT 1`
+
+	var holder lockHolder
+	err := r.db.QueryRow(ctx, query, key).Scan(&holder.pid, &holder.appName, &holder.clientAddr, &holder.backendStart)
+	if err != nil {
+		return holder, errors.Wrapf(err, "query %s failed", query)
+	}
+	return holder, nil
+}
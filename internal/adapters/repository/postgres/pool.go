@@ -0,0 +1,27 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/webdevelop-pro/go-common/logger"
+)
+
+// pool is a part of *pgxpool.Pool used by the repository, go-common *db.DB implements it too.
+type pool interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Acquire(ctx context.Context) (*pgxpool.Conn, error)
+	Ping(ctx context.Context) error
+}
+
+// NewWithPool returns new repository on top of existing connection pool.
+func NewWithPool(p *pgxpool.Pool) *Repository {
+	return &Repository{
+		db:  p,
+		log: logger.NewComponentLogger("postgres", nil),
+	}
+}
@@ -2,31 +2,43 @@ package postgres
 
 import (
 	"context"
+	"time"
 
-	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v5"
 	"github.com/pkg/errors"
 	"github.com/webdevelop-pro/go-common/configurator"
 	"github.com/webdevelop-pro/go-common/db"
+	"github.com/webdevelop-pro/go-common/logger"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
 	"github.com/webdevelop-pro/migration-service/internal/domain/migration_log"
 )
 
-const NO_TABLE_CODE = "42P01"
+const (
+	updateServiceVersionQuery     = `INSERT INTO migration_services (name, version) VALUES ($1, $2) ON CONFLICT(name) DO UPDATE SET version=$2`
+	writeMigrationServiceLogQuery = `INSERT INTO migration_service_logs (migration_services_name, priority, version, file_name, "sql", hash,
+		status, error, sqlstate, attempt, started_at, finished_at, duration_ms, env_name, host, binary_version, git_commit)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, ''), $10, $11, $12, $13,
+		NULLIF($14, ''), NULLIF($15, ''), NULLIF($16, ''), NULLIF($17, ''))`
+	markRolledBackQuery = `UPDATE migration_service_logs SET rolled_back_at=now()
+		WHERE migration_services_name = $1 AND version = $2 AND file_name = $3 AND priority = $4`
+)
 
 type Repository struct {
-	db *db.DB
+	db  pool
+	log logger.Logger
 }
 
 // New returns new DB instance.
 func New(c *configurator.Configurator) *Repository {
 	return &Repository{
-		db: db.New(c),
+		db:  db.New(c),
+		log: logger.NewComponentLogger("postgres", nil),
 	}
 }
 
 // UpdateServiceVersion updates service version.
 func (r *Repository) UpdateServiceVersion(ctx context.Context, name string, ver int) error {
-	const query = `INSERT INTO migration_services (name, version) VALUES ($1, $2) ON CONFLICT(name) DO UPDATE SET version=$2`
+	const query = updateServiceVersionQuery
 	_, err := r.db.Exec(ctx, query, name, ver)
 
 	if err != nil {
@@ -36,30 +48,48 @@ func (r *Repository) UpdateServiceVersion(ctx context.Context, name string, ver
 }
 
 // GetServiceVersion returns currently deployed version of the service.
+// Missing migration tables are created and the query is retried once.
 func (r *Repository) GetServiceVersion(ctx context.Context, name string) (int, error) {
+	ver, err := r.serviceVersion(ctx, name)
+	if isNoTableErr(err) {
+		if err := r.CreateMigrationTable(ctx); err != nil {
+			return 0, err
+		}
+		ver, err = r.serviceVersion(ctx, name)
+	}
+	return ver, err
+}
+
+// reader reads migration tables without creating or upgrading them.
+type reader struct {
+	r *Repository
+}
+
+// Reader returns read-only view of the repository used by dry runs.
+func (r *Repository) Reader() adapters.Reader {
+	return reader{r: r}
+}
+
+// GetServiceVersion returns version of the service, 0 if migration tables are missing.
+func (rd reader) GetServiceVersion(ctx context.Context, name string) (int, error) {
+	ver, err := rd.r.serviceVersion(ctx, name)
+	if isNoTableErr(err) {
+		return 0, nil
+	}
+	return ver, err
+}
+
+// serviceVersion returns version of the service from migration_services, 0 if there is no row.
+func (r *Repository) serviceVersion(ctx context.Context, name string) (int, error) {
 	const query = `SELECT version FROM migration_services WHERE name=$1`
 
-	var pgErr *pgconn.PgError
 	var ver int
-
 	err := r.db.QueryRow(ctx, query, name).Scan(&ver)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return 0, nil
-		}
-		// ToDo: Research why
-		// reflect.TypeOf(err) return *pgconn.PgError
-		// but errors.As(err, &pgErr) return false ...
-		// if errors.As(err, &pgErr) {
-		// if pgErr.Code == NO_TABLE_CODE {
-		sErr := err.Error()
-		if len(sErr) > 45 && sErr[0:45] == "ERROR: relation \"migration_services\" does not" {
-			if err := r.CreateMigrationTable(context.Background()); err != nil {
-				return 0, errors.Wrapf(err, "query %s failed, %s ", query, pgErr.Message)
-			}
-			return r.GetServiceVersion(ctx, name)
-		}
-		return 0, errors.Wrapf(err, "query %s failed, %s ", query, name)
+		return 0, errors.Wrapf(classify(err), "query %s failed, %s ", query, name)
 	}
 
 	return ver, nil
@@ -67,112 +97,132 @@ func (r *Repository) GetServiceVersion(ctx context.Context, name string) (int, e
 
 // Exec executes query
 func (r *Repository) Exec(ctx context.Context, sql string, arguments ...interface{}) error {
-	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
 		_, err := tx.Exec(ctx, sql, arguments...)
 
 		return err
 	})
+	return classify(err)
 }
 
-// CreateMigrationTable will create a migration table
-func (r *Repository) CreateMigrationTable(ctx context.Context) error {
-	const query = `CREATE TABLE IF NOT EXISTS migration_services (
-	id serial NOT NULL PRIMARY KEY,
-	name varchar NOT NULL UNIQUE,
-	version int NOT NULL DEFAULT 0,
-	created_at timestamp with time zone DEFAULT now() NOT NULL,
-	updated_at timestamp with time zone NOT NULL DEFAULT NOW()
-);
-CREATE OR REPLACE FUNCTION update_at_set_timestamp()
-RETURNS TRIGGER AS $$
-BEGIN
-  NEW.updated_at = NOW();
-  RETURN NEW;
-END;
-$$ LANGUAGE plpgsql;
-
-CREATE OR REPLACE TRIGGER set_timestamp_migration_services
-  BEFORE UPDATE ON migration_services
-  FOR EACH ROW
-  EXECUTE PROCEDURE update_at_set_timestamp();
-
-CREATE TABLE IF NOT EXISTS migration_service_logs
-(
-    id                      SERIAL PRIMARY KEY,
-
-    -- required
-    migration_services_name character varying(255) NOT NULL,
-    priority                integer                NOT NULL,
-    version                 integer                NOT NULL,
-    file_name               character varying(255) NOT NULL,
-    sql                     text                   NOT NULL,
-    hash                    character varying(255) NOT NULL,
-
-    -- dates
-    created_at              timestamptz            NOT NULL DEFAULT now(),
-    updated_at              timestamptz            NOT NULL DEFAULT now()
-);
-
-ALTER TABLE public.migration_service_logs DROP CONSTRAINT IF EXISTS migration_service_logs_complex_uindex;
-ALTER TABLE public.migration_service_logs
-    ADD CONSTRAINT migration_service_logs_complex_uindex
-        UNIQUE (migration_services_name, priority, version, file_name);
-
-CREATE OR REPLACE TRIGGER migration_service_logs_updated_at_timestamp
-    BEFORE UPDATE
-    ON migration_service_logs
-    FOR EACH ROW
-EXECUTE PROCEDURE update_at_set_timestamp();
-
-CREATE INDEX IF NOT EXISTS migration_service_logs_hash_index
-    on migration_service_logs (hash);
-`
-	_, err := r.db.Exec(ctx, query)
+// TransactionalDDL returns true: postgres runs DDL inside of a transaction.
+func (r *Repository) TransactionalDDL() bool {
+	return true
+}
 
+// Ping checks DB connectivity
+func (r *Repository) Ping(ctx context.Context) error {
+	return r.db.Ping(ctx)
+}
+
+// ExecNoTx executes statements of query one by one outside of a transaction on one connection,
+// so session settings and temporary tables of a statement are seen by the next ones.
+// Timeouts of ctx are set for the session of the query and reset after it.
+func (r *Repository) ExecNoTx(ctx context.Context, sql string, arguments ...interface{}) error {
+	conn, err := r.db.Acquire(ctx)
 	if err != nil {
-		return errors.Wrapf(err, "query %s failed.", query)
+		return err
 	}
+	defer conn.Release()
 
-	return nil
+	timeouts := adapters.TimeoutsFromContext(ctx)
+	if timeouts == (adapters.Timeouts{}) {
+		return execStatements(ctx, conn, sql, arguments...)
+	}
+
+	if err := setTimeouts(ctx, conn, timeouts, false); err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := conn.Exec(context.Background(), "RESET statement_timeout; RESET lock_timeout"); err != nil {
+			// connection with unknown session settings should not go back to the pool
+			_ = conn.Conn().Close(context.Background())
+		}
+	}()
+
+	return execStatements(ctx, conn, sql, arguments...)
 }
 
-// WriteMigrationServiceLog inserts row to migration_service_logs
+// WriteMigrationServiceLog inserts row to migration_service_logs.
+// Missing migration tables are created and the query is retried once.
 func (r *Repository) WriteMigrationServiceLog(ctx context.Context, log migration_log.MigrationServicesLog) error {
-	var pgErr *pgconn.PgError
-	const query = `INSERT INTO migration_service_logs (migration_services_name, priority, version, file_name, "sql", hash) 
-		VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT(migration_services_name, priority, version, file_name) DO UPDATE 
-		SET "sql"=$5, hash=$6`
-	_, err := r.db.Exec(ctx, query, log.MigrationServiceName, log.Priority, log.Version, log.FileName, log.SQL, log.Hash)
+	err := r.writeLog(ctx, log)
+	if isNoTableErr(err) || isNoColumnErr(err) {
+		if err := r.CreateMigrationTable(ctx); err != nil {
+			return err
+		}
+		err = r.writeLog(ctx, log)
+	}
+	return err
+}
+
+func (r *Repository) writeLog(ctx context.Context, log migration_log.MigrationServicesLog) error {
+	const query = writeMigrationServiceLogQuery
+	_, err := r.db.Exec(ctx, query, logArgs(log)...)
 
 	if err != nil {
-		sErr := err.Error()
-		if len(sErr) > 55 && sErr[0:55] == "ERROR: relation \"migration_service_logs\" does not exist" {
-			if err := r.CreateMigrationTable(context.Background()); err != nil {
-				return errors.Wrapf(err, "query %s failed, %s ", query, pgErr.Message)
-			}
-			return r.WriteMigrationServiceLog(ctx, log)
-		}
-		return errors.Wrapf(err, "query %s failed, params: MigrationServiceName = %s, Priority = %d, "+
+		return errors.Wrapf(classify(err), "query %s failed, params: MigrationServiceName = %s, Priority = %d, "+
 			"Version = %d, FileName = %s, SQL = %s, Hash = %s", query, log.MigrationServiceName, log.Priority,
 			log.Version, log.FileName, log.SQL, log.Hash)
 	}
 	return nil
 }
 
-// GetHashFromMigrationServiceLog returns hash from migration_service_logs
+// GetHashFromMigrationServiceLog returns hash of the last applied, tolerated or faked row of the migration from migration_service_logs.
+// Missing migration tables are created and the query is retried once.
 func (r *Repository) GetHashFromMigrationServiceLog(ctx context.Context, log migration_log.MigrationServicesLog) (string, error) {
+	hash, err := r.logHash(ctx, log)
+	if isNoTableErr(err) || isNoColumnErr(err) {
+		if err := r.CreateMigrationTable(ctx); err != nil {
+			return "", err
+		}
+		hash, err = r.logHash(ctx, log)
+	}
+	return hash, err
+}
+
+// GetHashFromMigrationServiceLog returns hash of the last applied row of the migration,
+// empty if migration tables or their columns are missing.
+func (rd reader) GetHashFromMigrationServiceLog(ctx context.Context, log migration_log.MigrationServicesLog) (string, error) {
+	hash, err := rd.r.logHash(ctx, log)
+	if isNoTableErr(err) || isNoColumnErr(err) {
+		return "", nil
+	}
+	return hash, err
+}
+
+// logHash returns hash of the last applied, tolerated or faked row of the migration which is not rolled back,
+// empty if there is no row.
+func (r *Repository) logHash(ctx context.Context, log migration_log.MigrationServicesLog) (string, error) {
 	var hash string
 	const query = `SELECT hash FROM migration_service_logs
-    	WHERE migration_services_name = $1 AND priority = $2 AND version = $3 AND file_name = $4`
+    	WHERE migration_services_name = $1 AND priority = $2 AND version = $3 AND file_name = $4
+    	AND status IN ('applied', 'tolerated', 'faked') AND rolled_back_at IS NULL ORDER BY id DESC LIMIT 1`
 	err := r.db.QueryRow(ctx, query, log.MigrationServiceName, log.Priority, log.Version, log.FileName).Scan(&hash)
 
 	if errors.Is(err, pgx.ErrNoRows) {
 		return "", nil
 	}
 	if err != nil {
-		return "", errors.Wrapf(err, "query %s failed, params: MigrationServiceName = %s, Priority = %d, "+
+		return "", errors.Wrapf(classify(err), "query %s failed, params: MigrationServiceName = %s, Priority = %d, "+
 			"Version = %d, FileName = %s", query, log.MigrationServiceName, log.Priority,
 			log.Version, log.FileName)
 	}
 	return hash, nil
 }
+
+// logArgs returns arguments of writeMigrationServiceLogQuery, zero times are written as NULL.
+func logArgs(log migration_log.MigrationServicesLog) []interface{} {
+	var startedAt, finishedAt *time.Time
+	if !log.StartedAt.IsZero() {
+		startedAt = &log.StartedAt
+	}
+	if !log.FinishedAt.IsZero() {
+		finishedAt = &log.FinishedAt
+	}
+	return []interface{}{
+		log.MigrationServiceName, log.Priority, log.Version, log.FileName, log.SQL, log.Hash,
+		log.Status, log.Error, log.SQLState, log.Attempt, startedAt, finishedAt, log.Duration.Milliseconds(),
+		log.EnvName, log.Host, log.BinaryVersion, log.GitCommit,
+	}
+}
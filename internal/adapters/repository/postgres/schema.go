@@ -0,0 +1,169 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+)
+
+// metaTable keeps the single row with version of bookkeeping tables, it's also used to derive upgrade lock key.
+const metaTable = "migration_service_meta"
+
+// schemaStep upgrades bookkeeping tables from version-1 to version.
+type schemaStep struct {
+	version     int
+	description string
+	query       string
+}
+
+// schemaSteps are executed in order, each one once. Never edit a released step, append a new one.
+var schemaSteps = []schemaStep{
+	{
+		version:     1,
+		description: "create migration_services and migration_service_logs",
+		query: `CREATE TABLE IF NOT EXISTS migration_services (
+	id serial NOT NULL PRIMARY KEY,
+	name varchar NOT NULL UNIQUE,
+	version int NOT NULL DEFAULT 0,
+	created_at timestamp with time zone DEFAULT now() NOT NULL,
+	updated_at timestamp with time zone NOT NULL DEFAULT NOW()
+);
+CREATE OR REPLACE FUNCTION update_at_set_timestamp()
+RETURNS TRIGGER AS $$
+BEGIN
+  NEW.updated_at = NOW();
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER set_timestamp_migration_services
+  BEFORE UPDATE ON migration_services
+  FOR EACH ROW
+  EXECUTE PROCEDURE update_at_set_timestamp();
+
+CREATE TABLE IF NOT EXISTS migration_service_logs
+(
+    id                      SERIAL PRIMARY KEY,
+
+    -- required
+    migration_services_name character varying(255) NOT NULL,
+    priority                integer                NOT NULL,
+    version                 integer                NOT NULL,
+    file_name               character varying(255) NOT NULL,
+    sql                     text                   NOT NULL,
+    hash                    character varying(255) NOT NULL,
+    status                  varchar(32)            NOT NULL DEFAULT 'applied',
+    error                   text,
+    sqlstate                varchar(5),
+    attempt                 int                    NOT NULL DEFAULT 1,
+    started_at              timestamptz,
+    finished_at             timestamptz,
+    duration_ms             bigint,
+
+    -- executor
+    env_name                varchar(255),
+    host                    varchar(255),
+    binary_version          varchar(255),
+    git_commit              varchar(64),
+
+    -- dates
+    created_at              timestamptz            NOT NULL DEFAULT now(),
+    updated_at              timestamptz            NOT NULL DEFAULT now(),
+    rolled_back_at          timestamptz
+);
+
+CREATE OR REPLACE TRIGGER migration_service_logs_updated_at_timestamp
+    BEFORE UPDATE
+    ON migration_service_logs
+    FOR EACH ROW
+EXECUTE PROCEDURE update_at_set_timestamp();
+
+CREATE INDEX IF NOT EXISTS migration_service_logs_hash_index
+    on migration_service_logs (hash);
+`,
+	},
+	{
+		// tables created before the schema was versioned miss columns and have a unique key,
+		// while every attempt is a row now
+		version:     2,
+		description: "upgrade migration_service_logs created by unversioned releases",
+		query: `ALTER TABLE migration_service_logs ADD COLUMN IF NOT EXISTS rolled_back_at timestamptz;
+ALTER TABLE migration_service_logs ADD COLUMN IF NOT EXISTS status varchar(32) NOT NULL DEFAULT 'applied';
+ALTER TABLE migration_service_logs ADD COLUMN IF NOT EXISTS error text;
+ALTER TABLE migration_service_logs ADD COLUMN IF NOT EXISTS sqlstate varchar(5);
+ALTER TABLE migration_service_logs ADD COLUMN IF NOT EXISTS attempt int NOT NULL DEFAULT 1;
+ALTER TABLE migration_service_logs ADD COLUMN IF NOT EXISTS started_at timestamptz;
+ALTER TABLE migration_service_logs ADD COLUMN IF NOT EXISTS finished_at timestamptz;
+ALTER TABLE migration_service_logs ADD COLUMN IF NOT EXISTS duration_ms bigint;
+ALTER TABLE migration_service_logs ADD COLUMN IF NOT EXISTS env_name varchar(255);
+ALTER TABLE migration_service_logs ADD COLUMN IF NOT EXISTS host varchar(255);
+ALTER TABLE migration_service_logs ADD COLUMN IF NOT EXISTS binary_version varchar(255);
+ALTER TABLE migration_service_logs ADD COLUMN IF NOT EXISTS git_commit varchar(64);
+
+ALTER TABLE migration_service_logs DROP CONSTRAINT IF EXISTS migration_service_logs_complex_uindex;
+CREATE INDEX IF NOT EXISTS migration_service_logs_migration_index
+    on migration_service_logs (migration_services_name, priority, version, file_name);
+`,
+	},
+}
+
+// CreateMigrationTable creates bookkeeping tables or upgrades them to the latest schemaSteps version.
+// Pending steps and the new version are committed in one transaction under advisory lock, so
+// concurrent instances do not run them twice. Returns SchemaVersionError if tables are newer than the binary.
+func (r *Repository) CreateMigrationTable(ctx context.Context) error {
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		const lockQuery = `SELECT pg_advisory_xact_lock(hashtextextended(current_database() || '.' || $1, 0))`
+		if _, err := tx.Exec(ctx, lockQuery, metaTable); err != nil {
+			return errors.Wrapf(err, "query %s failed", lockQuery)
+		}
+
+		const metaQuery = `CREATE TABLE IF NOT EXISTS migration_service_meta
+(
+    id             integer     NOT NULL PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+    schema_version integer     NOT NULL DEFAULT 0,
+    updated_at     timestamptz NOT NULL DEFAULT now()
+);
+INSERT INTO migration_service_meta (id) VALUES (1) ON CONFLICT (id) DO NOTHING;`
+		if _, err := tx.Exec(ctx, metaQuery); err != nil {
+			return errors.Wrapf(err, "query %s failed", metaQuery)
+		}
+
+		const versionQuery = `SELECT schema_version FROM migration_service_meta WHERE id = 1`
+		var version int
+		if err := tx.QueryRow(ctx, versionQuery).Scan(&version); err != nil {
+			return errors.Wrapf(err, "query %s failed", versionQuery)
+		}
+		known := schemaSteps[len(schemaSteps)-1].version
+		if err := adapters.CheckSchemaVersion(version, known); err != nil {
+			return err
+		}
+
+		// tables may be dropped after they were upgraded, the first step is idempotent,
+		// so it's executed every time to create them again
+		if version >= schemaSteps[0].version {
+			if _, err := tx.Exec(ctx, schemaSteps[0].query); err != nil {
+				return errors.Wrapf(err, "cannot create bookkeeping tables: %s", schemaSteps[0].description)
+			}
+		}
+		for _, step := range schemaSteps {
+			if step.version <= version {
+				continue
+			}
+			if _, err := tx.Exec(ctx, step.query); err != nil {
+				return errors.Wrapf(err, "bookkeeping schema upgrade to version %d failed: %s", step.version, step.description)
+			}
+			r.log.Info().Msgf("upgraded bookkeeping schema to version %d: %s", step.version, step.description)
+		}
+		if version == known {
+			return nil
+		}
+
+		const updateQuery = `UPDATE migration_service_meta SET schema_version = $1, updated_at = now() WHERE id = 1`
+		if _, err := tx.Exec(ctx, updateQuery, known); err != nil {
+			return errors.Wrapf(err, "query %s failed", updateQuery)
+		}
+		return nil
+	})
+}
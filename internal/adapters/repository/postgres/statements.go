@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration"
+)
+
+// execStatements executes statements of query one by one, so a failed one is reported
+// as adapters.StatementError with its position. Query with arguments is a single statement.
+func execStatements(ctx context.Context, db execer, query string, arguments ...interface{}) error {
+	if len(arguments) > 0 {
+		_, err := db.Exec(ctx, query, arguments...)
+		return queryError(ctx, err)
+	}
+
+	for i, statement := range migration.ParseStatements(query) {
+		if _, err := db.Exec(ctx, statement.SQL); err != nil {
+			return statementError(ctx, query, i+1, statement, err)
+		}
+	}
+	return nil
+}
+
+// statementError returns error of index-th statement of query located by PgError.Position.
+func statementError(ctx context.Context, query string, index int, statement migration.Statement, err error) error {
+	sErr := &adapters.StatementError{
+		File:      adapters.FileFromContext(ctx),
+		Index:     index,
+		Statement: statement.SQL,
+		Line:      statement.Line,
+		Column:    statement.Column,
+		Err:       queryError(ctx, err),
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		sErr.Code, sErr.Detail, sErr.Hint = pgErr.Code, pgErr.Detail, pgErr.Hint
+		if pgErr.Position > 0 {
+			// position is 1-based and counted in characters of the statement
+			offset := 0
+			for n := int32(1); n < pgErr.Position && offset < len(statement.SQL); n++ {
+				_, size := utf8.DecodeRuneInString(statement.SQL[offset:])
+				offset += size
+			}
+			sErr.Line, sErr.Column = migration.Position(query, statement.Offset+offset)
+		}
+	}
+	return sErr
+}
@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+)
+
+// execer is a connection or a transaction.
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+}
+
+// setTimeouts sets not zero statement_timeout and lock_timeout, for the current transaction only if local.
+func setTimeouts(ctx context.Context, db execer, timeouts adapters.Timeouts, local bool) error {
+	settings := make([]string, 0, 2)
+	args := make([]interface{}, 0, 2)
+	for _, t := range []struct {
+		name string
+		d    time.Duration
+	}{{"statement_timeout", timeouts.Statement}, {"lock_timeout", timeouts.Lock}} {
+		if t.d <= 0 {
+			continue
+		}
+		// 0 disables the timeout, so it's at least 1ms
+		ms := t.d.Milliseconds()
+		if ms < 1 {
+			ms = 1
+		}
+		args = append(args, strconv.FormatInt(ms, 10))
+		settings = append(settings, fmt.Sprintf("set_config('%s', $%d, %t)", t.name, len(args), local))
+	}
+	if len(settings) == 0 {
+		return nil
+	}
+
+	query := "SELECT " + strings.Join(settings, ", ")
+	if _, err := db.Exec(ctx, query, args...); err != nil {
+		return errors.Wrapf(err, "cannot set timeouts, statement: %s, lock: %s", timeouts.Statement, timeouts.Lock)
+	}
+	return nil
+}
+
+// timeoutError returns adapters.TimeoutError if query was canceled by timeouts of ctx.
+func timeoutError(ctx context.Context, err error) error {
+	timeouts := adapters.TimeoutsFromContext(ctx)
+	switch {
+	case timeouts.Statement > 0 && errors.Is(err, adapters.ErrQueryCanceled):
+		return &adapters.TimeoutError{Setting: "statement_timeout", Timeout: timeouts.Statement, Err: err}
+	case timeouts.Lock > 0 && errors.Is(err, adapters.ErrLockNotAvailable):
+		return &adapters.TimeoutError{Setting: "lock_timeout", Timeout: timeouts.Lock, Err: err}
+	}
+	return err
+}
+
+// transientClasses are classes of failures which may pass on the next attempt.
+var transientClasses = []error{adapters.ErrLockNotAvailable, adapters.ErrSerialization, adapters.ErrDeadlock}
+
+// queryError classifies error of a migration query: postgres errors become adapters.DBError,
+// timeouts of ctx become adapters.TimeoutError and transient failures are wrapped
+// to adapters.TransientError, so they can be retried.
+func queryError(ctx context.Context, err error) error {
+	var dbErr *adapters.DBError
+	if err == nil || errors.As(err, &dbErr) {
+		return err
+	}
+	err = classify(err)
+	if !errors.As(err, &dbErr) {
+		return err
+	}
+
+	err = timeoutError(ctx, err)
+	for _, class := range transientClasses {
+		if errors.Is(dbErr, class) {
+			return &adapters.TransientError{Code: dbErr.Code, Err: err}
+		}
+	}
+	return err
+}
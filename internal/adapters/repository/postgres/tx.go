@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration_log"
+)
+
+// Tx runs migration and bookkeeping queries inside of the transaction started by BeginFunc.
+type Tx struct {
+	tx pgx.Tx
+	// noTable is set when bookkeeping tables or columns are missing
+	noTable bool
+}
+
+// BeginFunc runs fn in a transaction, commits it if fn returns nil and rolls it back otherwise.
+// Timeouts of ctx are set with SET LOCAL semantics, so they end with the transaction.
+func (r *Repository) BeginFunc(ctx context.Context, fn func(tx adapters.Tx) error) error {
+	var t *Tx
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if err := setTimeouts(ctx, tx, adapters.TimeoutsFromContext(ctx), true); err != nil {
+			return err
+		}
+		t = &Tx{tx: tx}
+		return fn(t)
+	})
+
+	if err != nil && t != nil && t.noTable {
+		// whole unit of work was rolled back, so it's safe to create migration tables and run it again
+		if err := r.CreateMigrationTable(ctx); err != nil {
+			return err
+		}
+		err = pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+			if err := setTimeouts(ctx, tx, adapters.TimeoutsFromContext(ctx), true); err != nil {
+				return err
+			}
+			return fn(&Tx{tx: tx})
+		})
+	}
+	// commit of a serializable transaction can fail too
+	return queryError(ctx, err)
+}
+
+// Exec executes statements of query one by one in a savepoint, so failed query does not abort
+// the whole transaction and none of its statements stay applied.
+func (t *Tx) Exec(ctx context.Context, sql string, arguments ...interface{}) error {
+	return pgx.BeginFunc(ctx, t.tx, func(tx pgx.Tx) error {
+		return execStatements(ctx, tx, sql, arguments...)
+	})
+}
+
+// UpdateServiceVersion updates service version.
+func (t *Tx) UpdateServiceVersion(ctx context.Context, name string, ver int) error {
+	const query = updateServiceVersionQuery
+	_, err := t.tx.Exec(ctx, query, name, ver)
+
+	if err != nil {
+		t.noTable = isNoTableErr(err) || isNoColumnErr(err)
+		return errors.Wrapf(classify(err), "query %s failed, params: %s %d", query, name, ver)
+	}
+	return nil
+}
+
+// WriteMigrationServiceLog inserts row to migration_service_logs
+func (t *Tx) WriteMigrationServiceLog(ctx context.Context, log migration_log.MigrationServicesLog) error {
+	const query = writeMigrationServiceLogQuery
+	_, err := t.tx.Exec(ctx, query, logArgs(log)...)
+
+	if err != nil {
+		t.noTable = isNoTableErr(err) || isNoColumnErr(err)
+		return errors.Wrapf(classify(err), "query %s failed, params: MigrationServiceName = %s, Priority = %d, "+
+			"Version = %d, FileName = %s, SQL = %s, Hash = %s", query, log.MigrationServiceName, log.Priority,
+			log.Version, log.FileName, log.SQL, log.Hash)
+	}
+	return nil
+}
+
+// MarkMigrationServiceLogRolledBack marks migration_service_logs rows of the migration as rolled back
+func (t *Tx) MarkMigrationServiceLogRolledBack(ctx context.Context, log migration_log.MigrationServicesLog) error {
+	const query = markRolledBackQuery
+	_, err := t.tx.Exec(ctx, query, log.MigrationServiceName, log.Version, log.FileName, log.Priority)
+
+	if err != nil {
+		t.noTable = isNoTableErr(err) || isNoColumnErr(err)
+		return errors.Wrapf(classify(err), "query %s failed, params: MigrationServiceName = %s, Version = %d, FileName = %s, Priority = %d",
+			query, log.MigrationServiceName, log.Version, log.FileName, log.Priority)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"github.com/webdevelop-pro/go-common/configurator"
+	"github.com/webdevelop-pro/go-common/logger"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+	"github.com/webdevelop-pro/migration-service/internal/adapters/repository/memory"
+	"github.com/webdevelop-pro/migration-service/internal/adapters/repository/mysql"
+	"github.com/webdevelop-pro/migration-service/internal/adapters/repository/postgres"
+	"github.com/webdevelop-pro/migration-service/internal/adapters/repository/sqlite"
+)
+
+const (
+	TypePostgres = "postgres"
+	TypeSQLite   = "sqlite"
+	TypeMySQL    = "mysql"
+	TypeMemory   = "memory"
+)
+
+type Config struct {
+	// Type is a DB driver: postgres, sqlite, mysql or memory
+	Type string `default:"postgres"`
+}
+
+// New returns repository for DB_TYPE database.
+func New(c *configurator.Configurator) adapters.Repository {
+	cfg := c.New("repository", &Config{}, "db").(*Config)
+
+	switch cfg.Type {
+	case TypePostgres:
+		return postgres.New(c)
+	case TypeSQLite:
+		return sqlite.New(c)
+	case TypeMySQL:
+		return mysql.New(c)
+	case TypeMemory:
+		return memory.New(c)
+	default:
+		log := logger.NewComponentLogger("repository", nil)
+		log.Fatal().Msgf("unknown DB_TYPE %s, should be %s, %s, %s or %s", cfg.Type, TypePostgres, TypeSQLite, TypeMySQL, TypeMemory)
+		return nil
+	}
+}
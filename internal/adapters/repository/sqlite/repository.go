@@ -0,0 +1,271 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/webdevelop-pro/go-common/configurator"
+	"github.com/webdevelop-pro/go-common/logger"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration_log"
+
+	// registers "sqlite" driver, pure go so we still can build with CGO_ENABLED=0
+	_ "modernc.org/sqlite"
+)
+
+const (
+	updateServiceVersionQuery     = `INSERT INTO migration_services (name, version) VALUES (?, ?) ON CONFLICT(name) DO UPDATE SET version=excluded.version`
+	writeMigrationServiceLogQuery = `INSERT INTO migration_service_logs (migration_services_name, priority, version, file_name, "sql", hash,
+		status, error, sqlstate, attempt, started_at, finished_at, duration_ms, env_name, host, binary_version, git_commit)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''))`
+	markRolledBackQuery = `UPDATE migration_service_logs SET rolled_back_at=CURRENT_TIMESTAMP
+		WHERE migration_services_name = ? AND version = ? AND file_name = ? AND priority = ?`
+)
+
+type Config struct {
+	// Path is a path to the database file, ":memory:" is accepted too
+	Path string `required:"true"`
+}
+
+type Repository struct {
+	db  *sql.DB
+	log logger.Logger
+}
+
+// New returns new SQLite repository for SQLITE_PATH database.
+func New(c *configurator.Configurator) *Repository {
+	cfg := c.New("sqlite", &Config{}, "sqlite").(*Config)
+	r, err := Open(cfg.Path)
+	if err != nil {
+		l := logger.NewComponentLogger("sqlite", nil)
+		l.Fatal().Err(err).Msgf("cannot open sqlite database %s", cfg.Path)
+	}
+	return r
+}
+
+// Open returns new SQLite repository for database file at path.
+func Open(path string) (*Repository, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot open %s", path)
+	}
+	// SQLite allows only one writer at a time, one connection also keeps ":memory:" database alive
+	db.SetMaxOpenConns(1)
+
+	return &Repository{
+		db:  db,
+		log: logger.NewComponentLogger("sqlite", nil),
+	}, nil
+}
+
+// UpdateServiceVersion updates service version.
+func (r *Repository) UpdateServiceVersion(ctx context.Context, name string, ver int) error {
+	const query = updateServiceVersionQuery
+	_, err := r.db.ExecContext(ctx, query, name, ver)
+
+	if err != nil {
+		return errors.Wrapf(err, "query %s failed, params: %s %d", query, name, ver)
+	}
+	return nil
+}
+
+// GetServiceVersion returns currently deployed version of the service.
+// Missing migration tables are created and the query is retried once.
+func (r *Repository) GetServiceVersion(ctx context.Context, name string) (int, error) {
+	ver, err := r.serviceVersion(ctx, name)
+	if isNoTableErr(err) {
+		if err := r.CreateMigrationTable(ctx); err != nil {
+			return 0, err
+		}
+		ver, err = r.serviceVersion(ctx, name)
+	}
+	return ver, err
+}
+
+// reader reads migration tables without creating or upgrading them.
+type reader struct {
+	r *Repository
+}
+
+// Reader returns read-only view of the repository used by dry runs.
+func (r *Repository) Reader() adapters.Reader {
+	return reader{r: r}
+}
+
+// GetServiceVersion returns version of the service, 0 if migration tables are missing.
+func (rd reader) GetServiceVersion(ctx context.Context, name string) (int, error) {
+	ver, err := rd.r.serviceVersion(ctx, name)
+	if isNoTableErr(err) {
+		return 0, nil
+	}
+	return ver, err
+}
+
+// serviceVersion returns version of the service from migration_services, 0 if there is no row.
+func (r *Repository) serviceVersion(ctx context.Context, name string) (int, error) {
+	const query = `SELECT version FROM migration_services WHERE name=?`
+
+	var ver int
+	err := r.db.QueryRowContext(ctx, query, name).Scan(&ver)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, errors.Wrapf(err, "query %s failed, %s ", query, name)
+	}
+
+	return ver, nil
+}
+
+// TransactionalDDL returns true: SQLite runs DDL inside of a transaction.
+func (r *Repository) TransactionalDDL() bool {
+	return true
+}
+
+// Ping checks DB connectivity
+func (r *Repository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// Exec executes query in a transaction
+func (r *Repository) Exec(ctx context.Context, sql string, arguments ...interface{}) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, sql, arguments...); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ExecNoTx executes statements of query one by one outside of a transaction on one connection.
+func (r *Repository) ExecNoTx(ctx context.Context, sql string, arguments ...interface{}) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if len(arguments) > 0 {
+		_, err = conn.ExecContext(ctx, sql, arguments...)
+		return err
+	}
+	for i, statement := range migration.ParseStatements(sql) {
+		if _, err := conn.ExecContext(ctx, statement.SQL); err != nil {
+			return &adapters.StatementError{
+				File:      adapters.FileFromContext(ctx),
+				Index:     i + 1,
+				Statement: statement.SQL,
+				Line:      statement.Line,
+				Column:    statement.Column,
+				Err:       err,
+			}
+		}
+	}
+	return nil
+}
+
+// WriteMigrationServiceLog inserts row to migration_service_logs.
+// Missing migration tables are created and the query is retried once.
+func (r *Repository) WriteMigrationServiceLog(ctx context.Context, log migration_log.MigrationServicesLog) error {
+	err := r.writeLog(ctx, log)
+	if isNoTableErr(err) {
+		if err := r.CreateMigrationTable(ctx); err != nil {
+			return err
+		}
+		err = r.writeLog(ctx, log)
+	}
+	return err
+}
+
+func (r *Repository) writeLog(ctx context.Context, log migration_log.MigrationServicesLog) error {
+	const query = writeMigrationServiceLogQuery
+	_, err := r.db.ExecContext(ctx, query, logArgs(log)...)
+
+	if err != nil {
+		return errors.Wrapf(err, "query %s failed, params: MigrationServiceName = %s, Priority = %d, "+
+			"Version = %d, FileName = %s, SQL = %s, Hash = %s", query, log.MigrationServiceName, log.Priority,
+			log.Version, log.FileName, log.SQL, log.Hash)
+	}
+	return nil
+}
+
+// GetHashFromMigrationServiceLog returns hash of the last applied, tolerated or faked row of the migration from migration_service_logs.
+// Missing migration tables are created and the query is retried once.
+func (r *Repository) GetHashFromMigrationServiceLog(ctx context.Context, log migration_log.MigrationServicesLog) (string, error) {
+	hash, err := r.logHash(ctx, log)
+	if isNoTableErr(err) {
+		if err := r.CreateMigrationTable(ctx); err != nil {
+			return "", err
+		}
+		hash, err = r.logHash(ctx, log)
+	}
+	return hash, err
+}
+
+// GetHashFromMigrationServiceLog returns hash of the last applied row of the migration,
+// empty if migration tables or their columns are missing.
+func (rd reader) GetHashFromMigrationServiceLog(ctx context.Context, log migration_log.MigrationServicesLog) (string, error) {
+	hash, err := rd.r.logHash(ctx, log)
+	if isNoTableErr(err) {
+		return "", nil
+	}
+	return hash, err
+}
+
+// logHash returns hash of the last applied, tolerated or faked row of the migration which is not rolled back,
+// empty if there is no row.
+func (r *Repository) logHash(ctx context.Context, log migration_log.MigrationServicesLog) (string, error) {
+	var hash string
+	const query = `SELECT hash FROM migration_service_logs
+    	WHERE migration_services_name = ? AND priority = ? AND version = ? AND file_name = ?
+    	AND status IN ('applied', 'tolerated', 'faked') AND rolled_back_at IS NULL ORDER BY id DESC LIMIT 1`
+	err := r.db.QueryRowContext(ctx, query, log.MigrationServiceName, log.Priority, log.Version, log.FileName).Scan(&hash)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "query %s failed, params: MigrationServiceName = %s, Priority = %d, "+
+			"Version = %d, FileName = %s", query, log.MigrationServiceName, log.Priority,
+			log.Version, log.FileName)
+	}
+	return hash, nil
+}
+
+// Lock does not take any lock: SQLite database is a local file and SQLite serializes writers itself.
+func (r *Repository) Lock(ctx context.Context, key int64, timeout time.Duration) (func(), error) {
+	return func() {}, nil
+}
+
+// isNoTableErr returns true if query failed because of a missing table or column
+func isNoTableErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "no such table") || strings.Contains(msg, "no such column") ||
+		strings.Contains(msg, "has no column named")
+}
+
+// logArgs returns arguments of writeMigrationServiceLogQuery, zero times are written as NULL.
+func logArgs(log migration_log.MigrationServicesLog) []interface{} {
+	var startedAt, finishedAt *time.Time
+	if !log.StartedAt.IsZero() {
+		startedAt = &log.StartedAt
+	}
+	if !log.FinishedAt.IsZero() {
+		finishedAt = &log.FinishedAt
+	}
+	return []interface{}{
+		log.MigrationServiceName, log.Priority, log.Version, log.FileName, log.SQL, log.Hash,
+		log.Status, log.Error, log.SQLState, log.Attempt, startedAt, finishedAt, log.Duration.Milliseconds(),
+		log.EnvName, log.Host, log.BinaryVersion, log.GitCommit,
+	}
+}
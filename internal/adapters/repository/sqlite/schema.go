@@ -0,0 +1,260 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+)
+
+// schemaStep upgrades bookkeeping tables from version-1 to version.
+type schemaStep struct {
+	version     int
+	description string
+	up          func(ctx context.Context, tx *sql.Tx) error
+}
+
+// schemaSteps are executed in order, each one once. Never edit a released step, append a new one.
+var schemaSteps = []schemaStep{
+	{version: 1, description: "create migration_services and migration_service_logs", up: execQuery(createTablesQuery)},
+	{version: 2, description: "upgrade migration_service_logs created by unversioned releases", up: upgradeUnversioned},
+}
+
+const createTablesQuery = `CREATE TABLE IF NOT EXISTS migration_services (
+	id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+	name varchar NOT NULL UNIQUE,
+	version int NOT NULL DEFAULT 0,
+	created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER IF NOT EXISTS set_timestamp_migration_services
+  AFTER UPDATE ON migration_services
+  FOR EACH ROW
+BEGIN
+  UPDATE migration_services SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+` + createLogsTableQuery + `
+
+` + logsTriggersQuery
+
+// createLogsTableQuery creates migration_service_logs, every attempt is a row so there is no unique key.
+const createLogsTableQuery = `CREATE TABLE IF NOT EXISTS migration_service_logs
+(
+    id                      integer      NOT NULL PRIMARY KEY AUTOINCREMENT,
+
+    -- required
+    migration_services_name varchar(255) NOT NULL,
+    priority                integer      NOT NULL,
+    version                 integer      NOT NULL,
+    file_name               varchar(255) NOT NULL,
+    sql                     text         NOT NULL,
+    hash                    varchar(255) NOT NULL,
+    status                  varchar(32)  NOT NULL DEFAULT 'applied',
+    error                   text,
+    sqlstate                varchar(5),
+    attempt                 integer      NOT NULL DEFAULT 1,
+    started_at              timestamp,
+    finished_at             timestamp,
+    duration_ms             integer,
+
+    -- executor
+    env_name                varchar(255),
+    host                    varchar(255),
+    binary_version          varchar(255),
+    git_commit              varchar(64),
+
+    -- dates
+    created_at              timestamp    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at              timestamp    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    rolled_back_at          timestamp
+);`
+
+// logsTriggersQuery creates triggers and indexes of migration_service_logs, they are dropped together with the table.
+const logsTriggersQuery = `CREATE TRIGGER IF NOT EXISTS migration_service_logs_updated_at_timestamp
+  AFTER UPDATE ON migration_service_logs
+  FOR EACH ROW
+BEGIN
+  UPDATE migration_service_logs SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+CREATE INDEX IF NOT EXISTS migration_service_logs_hash_index
+    on migration_service_logs (hash);
+
+CREATE INDEX IF NOT EXISTS migration_service_logs_migration_index
+    on migration_service_logs (migration_services_name, priority, version, file_name);
+`
+
+// CreateMigrationTable creates bookkeeping tables or upgrades them to the latest schemaSteps version.
+// SQLite runs DDL in a transaction, so pending steps and the new version are committed together.
+// Returns SchemaVersionError if tables are newer than the binary.
+func (r *Repository) CreateMigrationTable(ctx context.Context) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "cannot begin transaction")
+	}
+	if err := r.upgradeSchema(ctx, tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "cannot commit bookkeeping schema upgrade")
+	}
+	return nil
+}
+
+func (r *Repository) upgradeSchema(ctx context.Context, tx *sql.Tx) error {
+	const metaQuery = `CREATE TABLE IF NOT EXISTS migration_service_meta
+(
+    id             integer   NOT NULL PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+    schema_version integer   NOT NULL DEFAULT 0,
+    updated_at     timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+INSERT OR IGNORE INTO migration_service_meta (id) VALUES (1);`
+	if _, err := tx.ExecContext(ctx, metaQuery); err != nil {
+		return errors.Wrapf(err, "query %s failed", metaQuery)
+	}
+
+	const versionQuery = `SELECT schema_version FROM migration_service_meta WHERE id = 1`
+	var version int
+	if err := tx.QueryRowContext(ctx, versionQuery).Scan(&version); err != nil {
+		return errors.Wrapf(err, "query %s failed", versionQuery)
+	}
+	known := schemaSteps[len(schemaSteps)-1].version
+	if err := adapters.CheckSchemaVersion(version, known); err != nil {
+		return err
+	}
+
+	// tables may be dropped after they were upgraded, the first step is idempotent,
+	// so it's executed every time to create them again
+	if version >= schemaSteps[0].version {
+		if err := schemaSteps[0].up(ctx, tx); err != nil {
+			return errors.Wrapf(err, "cannot create bookkeeping tables: %s", schemaSteps[0].description)
+		}
+	}
+	for _, step := range schemaSteps {
+		if step.version <= version {
+			continue
+		}
+		if err := step.up(ctx, tx); err != nil {
+			return errors.Wrapf(err, "bookkeeping schema upgrade to version %d failed: %s", step.version, step.description)
+		}
+		r.log.Info().Msgf("upgraded bookkeeping schema to version %d: %s", step.version, step.description)
+	}
+	if version == known {
+		return nil
+	}
+
+	const updateQuery = `UPDATE migration_service_meta SET schema_version = ?, updated_at = CURRENT_TIMESTAMP WHERE id = 1`
+	if _, err := tx.ExecContext(ctx, updateQuery, known); err != nil {
+		return errors.Wrapf(err, "query %s failed", updateQuery)
+	}
+	return nil
+}
+
+// execQuery returns step which executes query.
+func execQuery(query string) func(ctx context.Context, tx *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return errors.Wrapf(err, "query %s failed", query)
+		}
+		return nil
+	}
+}
+
+// logColumns are columns added to migration_service_logs by unversioned releases,
+// SQLite does not have ADD COLUMN IF NOT EXISTS.
+var logColumns = []struct {
+	name       string
+	definition string
+}{
+	{"status", "varchar(32) NOT NULL DEFAULT 'applied'"},
+	{"error", "text"},
+	{"attempt", "integer NOT NULL DEFAULT 1"},
+	{"sqlstate", "varchar(5)"},
+	{"started_at", "timestamp"},
+	{"finished_at", "timestamp"},
+	{"duration_ms", "integer"},
+	{"env_name", "varchar(255)"},
+	{"host", "varchar(255)"},
+	{"binary_version", "varchar(255)"},
+	{"git_commit", "varchar(64)"},
+}
+
+// upgradeUnversioned adds missing logColumns and drops the unique key on
+// (migration_services_name, priority, version, file_name), every attempt is a row now.
+// SQLite cannot drop a constraint, so migration_service_logs is rebuilt without it.
+func upgradeUnversioned(ctx context.Context, tx *sql.Tx) error {
+	if err := addLogColumns(ctx, tx); err != nil {
+		return err
+	}
+
+	const query = `SELECT count(*) FROM sqlite_master
+		WHERE type = 'index' AND tbl_name = 'migration_service_logs' AND name LIKE 'sqlite_autoindex_%'`
+	var n int
+	if err := tx.QueryRowContext(ctx, query).Scan(&n); err != nil {
+		return errors.Wrapf(err, "query %s failed", query)
+	}
+	if n == 0 {
+		return nil
+	}
+
+	columns := []string{
+		"id", "migration_services_name", "priority", "version", "file_name", `"sql"`, "hash",
+		"created_at", "updated_at", "rolled_back_at",
+	}
+	for _, column := range logColumns {
+		columns = append(columns, column.name)
+	}
+	list := strings.Join(columns, ", ")
+
+	queries := []string{
+		strings.Replace(createLogsTableQuery, "migration_service_logs", "migration_service_logs_new", 1),
+		"INSERT INTO migration_service_logs_new (" + list + ") SELECT " + list + " FROM migration_service_logs",
+		"DROP TABLE migration_service_logs",
+		"ALTER TABLE migration_service_logs_new RENAME TO migration_service_logs",
+		logsTriggersQuery,
+	}
+	for _, q := range queries {
+		if _, err := tx.ExecContext(ctx, q); err != nil {
+			return errors.Wrapf(err, "query %s failed", q)
+		}
+	}
+	return nil
+}
+
+// addLogColumns adds logColumns missing in migration_service_logs.
+func addLogColumns(ctx context.Context, tx *sql.Tx) error {
+	const query = `SELECT name FROM pragma_table_info('migration_service_logs')`
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return errors.Wrapf(err, "query %s failed", query)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return errors.Wrapf(err, "query %s failed", query)
+		}
+		existing[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrapf(err, "query %s failed", query)
+	}
+
+	for _, column := range logColumns {
+		if existing[column.name] {
+			continue
+		}
+		alter := "ALTER TABLE migration_service_logs ADD COLUMN " + column.name + " " + column.definition
+		if _, err := tx.ExecContext(ctx, alter); err != nil {
+			return errors.Wrapf(err, "query %s failed", alter)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration_log"
+)
+
+// Tx runs migration and bookkeeping queries inside of the transaction started by BeginFunc.
+type Tx struct {
+	tx *sql.Tx
+	// noTable is set when bookkeeping tables or columns are missing
+	noTable bool
+}
+
+// BeginFunc runs fn in a transaction, commits it if fn returns nil and rolls it back otherwise.
+func (r *Repository) BeginFunc(ctx context.Context, fn func(tx adapters.Tx) error) error {
+	t, err := r.beginFunc(ctx, fn)
+	if err != nil && t != nil && t.noTable {
+		// whole unit of work was rolled back, so it's safe to create migration tables and run it again
+		if err := r.CreateMigrationTable(ctx); err != nil {
+			return err
+		}
+		_, err = r.beginFunc(ctx, fn)
+	}
+	return err
+}
+
+func (r *Repository) beginFunc(ctx context.Context, fn func(tx adapters.Tx) error) (*Tx, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tx{tx: tx}
+	if err := fn(t); err != nil {
+		_ = tx.Rollback()
+		return t, err
+	}
+	return t, tx.Commit()
+}
+
+// Exec executes query in a savepoint, so failed query does not abort the whole transaction.
+func (t *Tx) Exec(ctx context.Context, sql string, arguments ...interface{}) error {
+	if _, err := t.tx.ExecContext(ctx, "SAVEPOINT migration"); err != nil {
+		return err
+	}
+	if _, err := t.tx.ExecContext(ctx, sql, arguments...); err != nil {
+		if _, rErr := t.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT migration"); rErr != nil {
+			return errors.Wrap(rErr, err.Error())
+		}
+		_, _ = t.tx.ExecContext(ctx, "RELEASE SAVEPOINT migration")
+		return err
+	}
+	_, err := t.tx.ExecContext(ctx, "RELEASE SAVEPOINT migration")
+	return err
+}
+
+// UpdateServiceVersion updates service version.
+func (t *Tx) UpdateServiceVersion(ctx context.Context, name string, ver int) error {
+	const query = updateServiceVersionQuery
+	_, err := t.tx.ExecContext(ctx, query, name, ver)
+
+	if err != nil {
+		t.noTable = isNoTableErr(err)
+		return errors.Wrapf(err, "query %s failed, params: %s %d", query, name, ver)
+	}
+	return nil
+}
+
+// WriteMigrationServiceLog inserts row to migration_service_logs
+func (t *Tx) WriteMigrationServiceLog(ctx context.Context, log migration_log.MigrationServicesLog) error {
+	const query = writeMigrationServiceLogQuery
+	_, err := t.tx.ExecContext(ctx, query, logArgs(log)...)
+
+	if err != nil {
+		t.noTable = isNoTableErr(err)
+		return errors.Wrapf(err, "query %s failed, params: MigrationServiceName = %s, Priority = %d, "+
+			"Version = %d, FileName = %s, SQL = %s, Hash = %s", query, log.MigrationServiceName, log.Priority,
+			log.Version, log.FileName, log.SQL, log.Hash)
+	}
+	return nil
+}
+
+// MarkMigrationServiceLogRolledBack marks migration_service_logs rows of the migration as rolled back
+func (t *Tx) MarkMigrationServiceLogRolledBack(ctx context.Context, log migration_log.MigrationServicesLog) error {
+	const query = markRolledBackQuery
+	_, err := t.tx.ExecContext(ctx, query, log.MigrationServiceName, log.Version, log.FileName, log.Priority)
+
+	if err != nil {
+		t.noTable = isNoTableErr(err)
+		return errors.Wrapf(err, "query %s failed, params: MigrationServiceName = %s, Version = %d, FileName = %s, Priority = %d",
+			query, log.MigrationServiceName, log.Version, log.FileName, log.Priority)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package adapters
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrSchemaVersion is returned when bookkeeping tables were upgraded by a newer migration service,
+// the binary does not know their schema so it refuses to touch them.
+var ErrSchemaVersion = errors.New("bookkeeping schema is newer than migration service")
+
+// SchemaVersionError reports version of bookkeeping tables and the latest version known by the binary,
+// errors.Is(err, ErrSchemaVersion) is true for it.
+type SchemaVersionError struct {
+	Version int
+	Known   int
+}
+
+func (e *SchemaVersionError) Error() string {
+	return fmt.Sprintf("%s: schema version %d, latest known version %d", ErrSchemaVersion, e.Version, e.Known)
+}
+
+func (e *SchemaVersionError) Is(target error) bool {
+	return target == ErrSchemaVersion
+}
+
+// CheckSchemaVersion returns SchemaVersionError if version of bookkeeping tables is newer than known.
+func CheckSchemaVersion(version, known int) error {
+	if version > known {
+		return &SchemaVersionError{Version: version, Known: known}
+	}
+	return nil
+}
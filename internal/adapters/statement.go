@@ -0,0 +1,39 @@
+package adapters
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StatementError is an error of one statement of a migration file with its location.
+type StatementError struct {
+	File string
+	// Index is 1-based number of the statement in the file
+	Index     int
+	Statement string
+	// Line and Column are 1-based position of the error in the file, or of the statement
+	// if DB does not report position of the error
+	Line   int
+	Column int
+	// Code is SQLSTATE of the error, Detail and Hint are reported by DB, if any
+	Code   string
+	Detail string
+	Hint   string
+	Err    error
+}
+
+func (e *StatementError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s:%d:%d: statement %d failed: %s", e.File, e.Line, e.Column, e.Index, e.Err)
+	if e.Detail != "" {
+		fmt.Fprintf(&b, ", detail: %s", e.Detail)
+	}
+	if e.Hint != "" {
+		fmt.Fprintf(&b, ", hint: %s", e.Hint)
+	}
+	return b.String()
+}
+
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
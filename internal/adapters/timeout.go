@@ -0,0 +1,52 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTimeout is returned when migration exceeds its statement_timeout, lock_timeout or timeout.
+var ErrTimeout = errors.New("migration timeout")
+
+// Timeouts are limits of DB session settings of a migration, zero means DB default.
+type Timeouts struct {
+	// Statement limits every statement, like postgres statement_timeout
+	Statement time.Duration
+	// Lock limits waiting for a table or row lock, like postgres lock_timeout
+	Lock time.Duration
+}
+
+type timeoutsCtxKey struct{}
+
+// WithTimeouts returns ctx which carries timeouts repository sets for queries executed with it.
+func WithTimeouts(ctx context.Context, t Timeouts) context.Context {
+	return context.WithValue(ctx, timeoutsCtxKey{}, t)
+}
+
+// TimeoutsFromContext returns timeouts set by WithTimeouts, or zero Timeouts.
+func TimeoutsFromContext(ctx context.Context) Timeouts {
+	t, _ := ctx.Value(timeoutsCtxKey{}).(Timeouts)
+	return t
+}
+
+// TimeoutError is an error of a migration canceled by a timeout, errors.Is(err, ErrTimeout) is true for it.
+type TimeoutError struct {
+	// Setting is statement_timeout, lock_timeout or timeout
+	Setting string
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s: %s %s exceeded: %s", ErrTimeout, e.Setting, e.Timeout, e.Err)
+}
+
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
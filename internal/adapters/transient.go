@@ -0,0 +1,29 @@
+package adapters
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTransient is returned for failures which may pass if the migration is executed again,
+// like lock_timeout, serialization failures and deadlocks.
+var ErrTransient = errors.New("transient error")
+
+// TransientError is an error of a query which is worth retrying, errors.Is(err, ErrTransient) is true for it.
+type TransientError struct {
+	// Code is SQLSTATE of the error
+	Code string
+	Err  error
+}
+
+func (e *TransientError) Error() string {
+	return fmt.Sprintf("%s %s: %s", ErrTransient, e.Code, e.Err)
+}
+
+func (e *TransientError) Is(target error) bool {
+	return target == ErrTransient
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
@@ -4,21 +4,30 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/webdevelop-pro/go-common/configurator"
 	"github.com/webdevelop-pro/lib/logger"
 	"github.com/webdevelop-pro/migration-service/internal/adapters"
 	"github.com/webdevelop-pro/migration-service/internal/domain/migration"
+	"github.com/webdevelop-pro/migration-service/internal/services"
 )
 
 const pkgName = "migration"
 
 type App struct {
-	log  logger.Logger
-	repo adapters.Repository
-	cfg  *GeneralConfig
-	set  *migration.Set
+	log          logger.Logger
+	repo         adapters.Repository
+	cfg          *GeneralConfig
+	migrationCfg *Config
+	set          *migration.Set
+	// mu serializes operations on set, since they can be called from http handlers concurrently
+	mu sync.Mutex
+	// status is a result of the last ApplyAll, used by readiness and health probes
+	status   services.Status
+	statusMu sync.RWMutex
 }
 
 func New(c *configurator.Configurator, repo adapters.Repository) *App {
@@ -28,22 +37,97 @@ func New(c *configurator.Configurator, repo adapters.Repository) *App {
 	if err := configurator.NewConfiguration(cfg); err != nil {
 		l.Fatal().Err(err).Msg("failed to get configuration of server")
 	}
+	migrationCfg := c.New("migration", &Config{}, "migration").(*Config)
+	set := migration.New(repo)
+	set.SetWorkers(migrationCfg.Workers)
+	set.SetTimeouts(migration.Timeouts{
+		Statement: migrationCfg.StatementTimeout,
+		Lock:      migrationCfg.QueryLockTimeout,
+		Migration: migrationCfg.Timeout,
+	})
+	set.SetRetry(migration.Retry{
+		Retries:    migrationCfg.Retries,
+		Backoff:    migrationCfg.RetryBackoff,
+		MaxBackoff: migrationCfg.RetryMaxBackoff,
+	})
+	set.SetExecutor(executor(cfg.EnvName))
+
 	return &App{
-		log:  l,
-		repo: repo,
-		cfg:  cfg,
-		set:  migration.New(repo),
+		log:          l,
+		repo:         repo,
+		cfg:          cfg,
+		migrationCfg: migrationCfg,
+		set:          set,
+		status:       services.Status{State: services.StatePending, UpdatedAt: time.Now()},
+	}
+}
+
+// Status returns result of the last ApplyAll.
+func (a *App) Status() services.Status {
+	a.statusMu.RLock()
+	defer a.statusMu.RUnlock()
+
+	return a.status
+}
+
+func (a *App) setStatus(state string, applied int, err error) {
+	a.statusMu.Lock()
+	defer a.statusMu.Unlock()
+
+	a.status = services.Status{State: state, Applied: applied, UpdatedAt: time.Now()}
+	if err != nil {
+		a.status.Error = err.Error()
 	}
 }
 
-func (a *App) ApplyAll(dir string) error {
+// Ping checks DB connectivity.
+func (a *App) Ping(ctx context.Context) error {
+	return a.repo.Ping(ctx)
+}
+
+// lock takes cluster-wide migration lock, so only one instance changes DB at a time,
+// and upgrades bookkeeping tables.
+func (a *App) lock(ctx context.Context) (func(), error) {
+	unlock, err := a.repo.Lock(ctx, a.migrationCfg.LockKey, a.migrationCfg.LockTimeout)
+	if err != nil {
+		a.log.Error().Err(err).Msg("failed to take migration lock")
+		return nil, err
+	}
+	if err := a.repo.CreateMigrationTable(ctx); err != nil {
+		unlock()
+		a.log.Error().Err(err).Msg("failed to upgrade migration tables")
+		return nil, err
+	}
+	return unlock, nil
+}
+
+func (a *App) ApplyAll(dir string) (err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	n := 0
+	a.setStatus(services.StateRunning, n, nil)
+	defer func() {
+		if err != nil {
+			a.setStatus(services.StateFailed, n, err)
+		} else {
+			a.setStatus(services.StateSucceeded, n, nil)
+		}
+	}()
+
+	unlock, err := a.lock(context.Background())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	a.set.ClearData()
-	err := migration.ReadDir(dir, "", a.set)
+	err = migration.ReadDir(dir, "", a.set)
 	if err != nil {
 		a.log.Error().Err(err).Msgf("can't get migration data from directory: %s", dir)
-		panic(err)
+		return err
 	}
-	n, err := a.set.ApplyAll(false, a.cfg.EnvName)
+	n, err = a.set.ApplyAll(context.Background(), false, a.cfg.EnvName)
 	if err != nil {
 		a.log.Error().Err(err).Msg("failed to apply all migrations")
 		return err
@@ -52,47 +136,80 @@ func (a *App) ApplyAll(dir string) error {
 	return nil
 }
 
-func (a *App) Apply(ctx context.Context, serviceName string) (int, error) {
-	if serviceName == "" || !a.set.ServiceExists(serviceName) {
-		return 0, fmt.Errorf("service '%s' not found", serviceName)
-	}
+// Plan returns what ApplyAll would do for dir without executing anything.
+func (a *App) Plan(dir string) (migration.Plan, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 
-	ver, err := a.repo.GetServiceVersion(ctx, serviceName)
+	a.set.ClearData()
+	err := migration.ReadDir(dir, "", a.set)
 	if err != nil {
-		return 0, errors.Wrap(err, "failed to get current service version")
+		a.log.Error().Err(err).Msgf("can't get migration data from directory: %s", dir)
+		return migration.Plan{}, err
+	}
+	plan, err := a.set.Plan(context.Background(), false, a.cfg.EnvName)
+	if err != nil {
+		a.log.Error().Err(err).Msg("failed to plan migrations")
+		return plan, err
 	}
+	return plan, nil
+}
+
+func (a *App) Apply(ctx context.Context, serviceName string) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 
-	n, lastVersion, err := a.set.Apply(serviceName, -1, ver, ver, a.cfg.EnvName)
+	a.set.ClearData()
+	err := migration.ReadDir(a.migrationCfg.Dir, "", a.set)
 	if err != nil {
-		return 0, errors.Wrap(err, "failed to apply migrations")
+		a.log.Error().Err(err).Msgf("can't get migration data from directory: %s", a.migrationCfg.Dir)
+		return 0, err
 	}
 
-	if lastVersion > ver {
-		if err := a.repo.UpdateServiceVersion(ctx, serviceName, lastVersion); err != nil {
-			a.log.Error().Err(err).Msg("failed to bump service version")
-		}
+	if serviceName == "" || !a.set.ServiceExists(serviceName) {
+		return 0, errors.Wrapf(services.ErrServiceNotFound, "service '%s'", serviceName)
 	}
 
+	unlock, err := a.lock(ctx)
 	if err != nil {
-		return 0, errors.Wrap(err, "failed to encode response")
+		return 0, err
+	}
+	defer unlock()
+
+	// migrations are logged with priority of their folder, so service is applied folder by folder
+	n := 0
+	for _, priority := range a.set.ServicePriorities(serviceName) {
+		ver, err := a.repo.GetServiceVersion(ctx, serviceName)
+		if err != nil {
+			return n, errors.Wrap(err, "failed to get current service version")
+		}
+
+		applied, _, err := a.set.Apply(ctx, serviceName, priority, ver, ver, a.cfg.EnvName)
+		n += applied
+		if err != nil {
+			return n, errors.Wrap(err, "failed to apply migrations")
+		}
 	}
 
 	return n, nil
 }
 
 func (a *App) GetSQL(ctx context.Context, dir string, serviceName string) (sql string, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
 	a.set.ClearData()
 	err = migration.ReadDir(dir, "", a.set)
 	if err != nil {
 		a.log.Error().Err(err).Msgf("can't get migration data from directory: %s", dir)
-		panic(err)
+		return "", err
 	}
 
 	if serviceName == "" || !a.set.ServiceExists(serviceName) {
-		return "", fmt.Errorf("service '%s' not found", serviceName)
+		return "", errors.Wrapf(services.ErrServiceNotFound, "service '%s'", serviceName)
 	}
 
-	ver, err := a.repo.GetServiceVersion(ctx, serviceName)
+	ver, err := adapters.ReaderOf(a.repo).GetServiceVersion(ctx, serviceName)
 	if err != nil {
 		return "", errors.Wrap(err, "failed to get current service version")
 	}
@@ -105,14 +222,68 @@ func (a *App) GetSQL(ctx context.Context, dir string, serviceName string) (sql s
 	return
 }
 
+func (a *App) Rollback(ctx context.Context, dir string, serviceName string, targetVersion int) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	unlock, err := a.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	a.set.ClearData()
+	err = migration.ReadDir(dir, "", a.set)
+	if err != nil {
+		a.log.Error().Err(err).Msgf("can't get migration data from directory: %s", dir)
+		return 0, err
+	}
+
+	if serviceName == "" || !a.set.ServiceExists(serviceName) {
+		return 0, errors.Wrapf(services.ErrServiceNotFound, "service '%s'", serviceName)
+	}
+
+	ver, err := a.repo.GetServiceVersion(ctx, serviceName)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get current service version")
+	}
+
+	if targetVersion < 0 || targetVersion >= ver {
+		return 0, fmt.Errorf("target version %d should be lower than current version %d of '%s'", targetVersion, ver, serviceName)
+	}
+
+	n, err := a.set.Rollback(ctx, serviceName, targetVersion, ver, a.cfg.EnvName)
+	if err != nil {
+		a.log.Error().Err(err).Msgf("failed to rollback %s", serviceName)
+		return n, err
+	}
+	a.log.Info().Int("n", n).Msgf("rolled back %s to version %d", serviceName, targetVersion)
+	return n, nil
+}
+
 func (a *App) Init(ctx context.Context) error {
 	return a.repo.CreateMigrationTable(ctx)
 }
 
 func (a *App) ForceApply(args []string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	unlock, err := a.lock(context.Background())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return a.forceApply(args)
+}
+
+func (a *App) forceApply(args []string) error {
 	a.set.ClearData()
-	a.getMigrationDataFromAppArgs(args)
-	n, err := a.set.ApplyAll(true, a.cfg.EnvName)
+	if err := a.getMigrationDataFromAppArgs(args); err != nil {
+		return err
+	}
+	n, err := a.set.ApplyAll(context.Background(), true, a.cfg.EnvName)
 	if err != nil {
 		a.log.Error().Err(err).Msg("failed to force apply all migrations")
 		return err
@@ -122,9 +293,20 @@ func (a *App) ForceApply(args []string) error {
 }
 
 func (a *App) FakeApply(args []string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	unlock, err := a.lock(context.Background())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	a.set.ClearData()
-	a.getMigrationDataFromAppArgs(args)
-	n, err := a.set.FakeAll()
+	if err := a.getMigrationDataFromAppArgs(args); err != nil {
+		return err
+	}
+	n, err := a.set.FakeAll(context.Background())
 	if err != nil {
 		a.log.Error().Err(err).Msg("failed to skip migrations")
 		return err
@@ -134,9 +316,14 @@ func (a *App) FakeApply(args []string) error {
 }
 
 func (a *App) CheckMigrationHash(args []string) (allEqual bool, list []string, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
 	a.set.ClearData()
-	a.getMigrationDataFromAppArgs(args)
-	allEqual, list, err = a.set.CheckMigrationHash()
+	if err = a.getMigrationDataFromAppArgs(args); err != nil {
+		return
+	}
+	allEqual, list, err = a.set.CheckMigrationHash(context.Background())
 	if err != nil {
 		a.log.Error().Err(err).Msg("failed to check migrations")
 		return
@@ -156,9 +343,20 @@ func (a *App) CheckMigrationHash(args []string) (allEqual bool, list []string, e
 }
 
 func (a *App) CheckAndApplyMigrations(args []string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	unlock, err := a.lock(context.Background())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	a.set.ClearData()
-	a.getMigrationDataFromAppArgs(args)
-	allEqual, list, err := a.set.CheckMigrationHash()
+	if err := a.getMigrationDataFromAppArgs(args); err != nil {
+		return err
+	}
+	allEqual, list, err := a.set.CheckMigrationHash(context.Background())
 	if err != nil {
 		a.log.Error().Err(err).Msg("failed to check migrations while executing CheckAndApplyMigrations")
 		return err
@@ -174,7 +372,7 @@ func (a *App) CheckAndApplyMigrations(args []string) error {
 		str += "\nTrying apply migrations"
 		a.log.Warn().Msg(str)
 
-		err = a.ForceApply(list)
+		err = a.forceApply(list)
 		if err != nil {
 			return err
 		}
@@ -183,12 +381,13 @@ func (a *App) CheckAndApplyMigrations(args []string) error {
 	return nil
 }
 
-func (a *App) getMigrationDataFromAppArgs(args []string) {
+// getMigrationDataFromAppArgs reads migrations from files and dirs passed as arguments.
+func (a *App) getMigrationDataFromAppArgs(args []string) error {
 	for _, path := range args {
 		pathInfo, err := os.Stat(path)
 		if err != nil {
 			a.log.Error().Err(err).Msgf("can't read info data from path: %s", path)
-			panic(err)
+			return &migration.LoadError{Kind: migration.ErrUnreadable, Path: path, Err: err}
 		}
 
 		if pathInfo.IsDir() {
@@ -199,7 +398,8 @@ func (a *App) getMigrationDataFromAppArgs(args []string) {
 
 		if err != nil {
 			a.log.Error().Err(err).Msgf("can't get migration data from path: %s", path)
-			panic(err)
+			return err
 		}
 	}
+	return nil
 }
@@ -0,0 +1,32 @@
+package app
+
+import (
+	"os"
+	"runtime/debug"
+
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration"
+)
+
+// Version and Commit of the binary, set by make.sh with -ldflags "-X".
+var (
+	Version string
+	Commit  string
+)
+
+// executor returns who applies migrations, it's written to every row of migration_service_logs.
+func executor(envName string) migration.Executor {
+	host, _ := os.Hostname()
+	e := migration.Executor{EnvName: envName, Host: host, Version: Version, Commit: Commit}
+	if e.Commit != "" {
+		return e
+	}
+	// go build without ldflags still stamps vcs revision
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				e.Commit = setting.Value
+			}
+		}
+	}
+	return e
+}
@@ -1,7 +1,26 @@
 package app
 
+import "time"
+
 type Config struct {
 	Dir string `required:"true"`
+	// LockKey is a key for pg_advisory_lock, by default derived from database and migration table name
+	LockKey int64 `split_words:"true"`
+	// LockTimeout is how long to wait for the lock taken by another instance
+	LockTimeout time.Duration `split_words:"true" default:"5m"`
+	// StatementTimeout is postgres statement_timeout of migrations, zero means DB default
+	StatementTimeout time.Duration `split_words:"true"`
+	// QueryLockTimeout is postgres lock_timeout of migrations, unlike LockTimeout it limits waiting for table and row locks
+	QueryLockTimeout time.Duration `split_words:"true"`
+	// Timeout is a deadline of every migration, zero means no deadline
+	Timeout time.Duration
+	// Retries is number of retries of a migration failed by lock_timeout, serialization failure or deadlock
+	Retries int
+	// RetryBackoff is a pause before the first retry, it's doubled for every next one up to RetryMaxBackoff
+	RetryBackoff    time.Duration `split_words:"true" default:"1s"`
+	RetryMaxBackoff time.Duration `split_words:"true" default:"30s"`
+	// Workers is number of services of one priority applied concurrently, every worker uses its own DB connection
+	Workers int `default:"1"`
 }
 
 type GeneralConfig struct {
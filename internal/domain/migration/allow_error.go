@@ -0,0 +1,84 @@
+package migration
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+)
+
+// sqlStateRe matches SQLSTATE codes, e.g. 42P07, every code has a digit, so words are not codes
+var sqlStateRe = regexp.MustCompile(`^[0-9A-Z]*[0-9][0-9A-Z]*$`)
+
+// conditionNames are postgres condition names allow_error accepts instead of SQLSTATE codes.
+var conditionNames = map[string]string{
+	"unique_violation":              "23505",
+	"foreign_key_violation":         "23503",
+	"not_null_violation":            "23502",
+	"check_violation":               "23514",
+	"dependent_objects_still_exist": "2BP01",
+	"invalid_schema_name":           "3F000",
+	"serialization_failure":         "40001",
+	"deadlock_detected":             "40P01",
+	"syntax_error":                  "42601",
+	"insufficient_privilege":        "42501",
+	"undefined_column":              "42703",
+	"undefined_function":            "42883",
+	"undefined_table":               "42P01",
+	"undefined_object":              "42704",
+	"duplicate_column":              "42701",
+	"duplicate_database":            "42P04",
+	"duplicate_function":            "42723",
+	"duplicate_object":              "42710",
+	"duplicate_schema":              "42P06",
+	"duplicate_table":               "42P07",
+	"invalid_table_definition":      "42P16",
+	"lock_not_available":            "55P03",
+	"object_in_use":                 "55006",
+	"query_canceled":                "57014",
+	"feature_not_supported":         "0A000",
+}
+
+// allowErrorDirective accepts a boolean or a list of SQLSTATE codes and condition names.
+func allowErrorDirective(m *Migration, value string) error {
+	if v, ok := parseBool(value); ok {
+		m.AllowError = v
+		m.AllowErrors = nil
+		return nil
+	}
+
+	codes := make([]string, 0)
+	for _, item := range splitList(value) {
+		if code, ok := conditionNames[strings.ToLower(item)]; ok {
+			codes = append(codes, code)
+			continue
+		}
+		if len(item) != 5 || !sqlStateRe.MatchString(strings.ToUpper(item)) {
+			return errors.Errorf("'%s' is neither a boolean, nor SQLSTATE code or condition name", item)
+		}
+		codes = append(codes, strings.ToUpper(item))
+	}
+	m.AllowError = true
+	m.AllowErrors = codes
+	return nil
+}
+
+// tolerates returns true if migration continues after err by allow_error.
+// Timeouts are never tolerated, listed SQLSTATEs are matched only for DBs which report them.
+func (m Migration) tolerates(ctx context.Context, err error) bool {
+	if !m.AllowError || isTimeout(ctx, err) {
+		return false
+	}
+	if len(m.AllowErrors) == 0 {
+		return true
+	}
+	code := adapters.SQLState(err)
+	for _, allowed := range m.AllowErrors {
+		if code == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package migration
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Errors of loading migrations, returned wrapped into LoadError with the path.
+var (
+	ErrBadFileName      = errors.New("bad migration file name")
+	ErrBadServiceFolder = errors.New("bad service folder name")
+	ErrUnreadable       = errors.New("cannot read migrations")
+	ErrDuplicateVersion = errors.New("duplicated migration version")
+	ErrDependency       = errors.New("bad migration dependency")
+)
+
+// LoadError is an error of loading migrations from path.
+// errors.Is matches Kind, errors.Unwrap returns the cause, e.g. fs.ErrNotExist.
+type LoadError struct {
+	Kind    error
+	Path    string
+	Message string
+	Err     error
+}
+
+func newLoadError(kind error, path string, err error, format string, args ...interface{}) *LoadError {
+	return &LoadError{Kind: kind, Path: path, Message: fmt.Sprintf(format, args...), Err: err}
+}
+
+func (e *LoadError) Error() string {
+	msg := fmt.Sprintf("%s: %s", e.Kind, e.Path)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *LoadError) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// ServiceError is an error of applying migrations of a service.
+type ServiceError struct {
+	Service string
+	Err     error
+}
+
+func (e ServiceError) Error() string {
+	return e.Service + ": " + e.Err.Error()
+}
+
+func (e ServiceError) Unwrap() error {
+	return e.Err
+}
+
+// ApplyError collects errors of services applied concurrently, errors.Is and errors.As check all of them.
+type ApplyError struct {
+	Errors []ServiceError
+}
+
+func (e *ApplyError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("failed to apply migrations of %d services: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+func (e *ApplyError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+func newBlockedError(st *step) error {
+	return errors.Errorf("%s is not applied, it waits for failed migrations", st)
+}
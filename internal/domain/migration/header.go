@@ -0,0 +1,217 @@
+package migration
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Header of a migration is a block of leading comment lines with `key: value` directives:
+//
+//	-- allow_error: true
+//	-- required_env: "^(dev|stage)-.*$", no_transaction: true
+//	-- description: adds email index
+//	-- lock_timeout: 5s, timeout: 10m
+//
+// Several pairs may be written on one line separated by commas, values may be quoted.
+// Comment lines which are not `key: value` pairs are ignored, the header ends on the first SQL line.
+
+// directive applies value of a header key to the migration.
+type directive func(m *Migration, value string) error
+
+// directives are known header keys, add a new one here to support it.
+var directives = map[string]directive{
+	"allow_error":    allowErrorDirective,
+	"no_transaction": boolDirective(func(m *Migration, v bool) { m.NoTransaction = v }),
+	"repeatable":     boolDirective(func(m *Migration, v bool) { m.Repeatable = v }),
+	"required_env": func(m *Migration, value string) error {
+		m.EnvRegex = value
+		return nil
+	},
+	"depends_on": func(m *Migration, value string) error {
+		deps, err := parseDependencies(value)
+		m.DependsOn = append(m.DependsOn, deps...)
+		return err
+	},
+	"description": func(m *Migration, value string) error {
+		m.Description = value
+		return nil
+	},
+	"tags": func(m *Migration, value string) error {
+		m.Tags = splitList(value)
+		return nil
+	},
+	"statement_timeout": durationDirective(func(m *Migration, v time.Duration) { m.Timeouts.Statement = v }),
+	"lock_timeout":      durationDirective(func(m *Migration, v time.Duration) { m.Timeouts.Lock = v }),
+	"timeout":           durationDirective(func(m *Migration, v time.Duration) { m.Timeouts.Migration = v }),
+}
+
+func boolDirective(set func(m *Migration, v bool)) directive {
+	return func(m *Migration, value string) error {
+		v, ok := parseBool(value)
+		if !ok {
+			return errors.Errorf("'%s' is not a boolean", value)
+		}
+		set(m, v)
+		return nil
+	}
+}
+
+func parseBool(value string) (bool, bool) {
+	switch strings.ToLower(value) {
+	case "true", "1", "yes", "on":
+		return true, true
+	case "false", "0", "no", "off":
+		return false, true
+	}
+	return false, false
+}
+
+func durationDirective(set func(m *Migration, v time.Duration)) directive {
+	return func(m *Migration, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return errors.Errorf("'%s' is not a duration like 30s or 5m", value)
+		}
+		set(m, d)
+		return nil
+	}
+}
+
+// splitList splits a comma or space separated value, e.g. tags.
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+}
+
+// parseDependencies parses comma separated service@version list of depends_on,
+// version can be omitted to depend on all migrations of the service.
+func parseDependencies(value string) ([]Dependency, error) {
+	deps := make([]Dependency, 0)
+	for _, item := range splitList(value) {
+		dep := Dependency{Service: item}
+		if i := strings.LastIndex(item, "@"); i >= 0 {
+			ver, err := strconv.Atoi(item[i+1:])
+			if err != nil || ver <= 0 {
+				return deps, errors.Errorf("'%s' should be <service>@<version>", item)
+			}
+			dep = Dependency{Service: item[:i], Version: ver}
+		}
+		if dep.Service == "" {
+			return deps, errors.Errorf("'%s' does not have service name", item)
+		}
+		deps = append(deps, dep)
+	}
+	return deps, nil
+}
+
+// headerPair is a single `key: value` pair of the header.
+type headerPair struct {
+	Key   string
+	Value string
+}
+
+var (
+	// pairRe matches beginning of a pair, value must not start with // so urls are plain comments
+	pairRe = regexp.MustCompile(`^([a-z][a-z0-9_]*)\s*:(?:\s+|$|[^/\s])`)
+	// nextPairRe matches a comma which starts the next pair on the same line
+	nextPairRe = regexp.MustCompile(`^,\s*[a-z][a-z0-9_]*\s*:`)
+)
+
+// parseHeader returns `key: value` pairs of the leading comment lines of query,
+// a line with syntax error is reported and the rest of header is still parsed.
+func parseHeader(query string) ([]headerPair, []error) {
+	pairs := make([]headerPair, 0)
+	var errs []error
+	for _, line := range strings.Split(query, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+		// strip comment dashes, "--- key: value" and "-- -- key: value" are accepted as well
+		line = strings.TrimLeft(line, "- \t")
+
+		linePairs, err := parseHeaderLine(line)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		pairs = append(pairs, linePairs...)
+	}
+	return pairs, errs
+}
+
+// parseHeaderLine parses comma separated pairs of a single comment line.
+func parseHeaderLine(line string) ([]headerPair, error) {
+	pairs := make([]headerPair, 0)
+	for line != "" {
+		m := pairRe.FindStringSubmatch(line)
+		if m == nil {
+			// plain comment
+			return pairs, nil
+		}
+		key := m[1]
+		rest := strings.TrimSpace(line[strings.Index(line, ":")+1:])
+
+		value, rest, err := parseHeaderValue(rest)
+		if err != nil {
+			return pairs, errors.Wrapf(err, "%s", key)
+		}
+		pairs = append(pairs, headerPair{Key: key, Value: value})
+
+		if rest == "" {
+			break
+		}
+		// parseHeaderValue stops only before a comma of the next pair
+		line = strings.TrimSpace(rest[1:])
+	}
+	return pairs, nil
+}
+
+// parseHeaderValue reads a quoted or a plain value and returns rest of the line after it.
+// Plain value lasts until a comma followed by the next `key:`, so regexes like a{1,3} are kept.
+func parseHeaderValue(s string) (value, rest string, err error) {
+	if s != "" && (s[0] == '"' || s[0] == '\'') {
+		end := closingQuote(s)
+		if end < 0 {
+			return "", "", errors.Errorf("unterminated quoted value %s", s)
+		}
+		if s[0] == '"' {
+			value, err = strconv.Unquote(s[:end+1])
+			if err != nil {
+				return "", "", errors.Wrapf(err, "invalid quoted value %s", s[:end+1])
+			}
+		} else {
+			value = s[1:end]
+		}
+		rest = strings.TrimSpace(s[end+1:])
+		if rest != "" && !nextPairRe.MatchString(rest) {
+			return "", "", errors.Errorf("unexpected '%s' after quoted value", rest)
+		}
+		return value, rest, nil
+	}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == ',' && nextPairRe.MatchString(s[i:]) {
+			return strings.TrimSpace(s[:i]), s[i:], nil
+		}
+	}
+	return strings.TrimSpace(s), "", nil
+}
+
+// closingQuote returns index of the quote closing s[0], backslash escapes are skipped in double quotes.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && s[0] == '"':
+			i++
+		case s[i] == s[0]:
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,59 @@
+package migration
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration_log"
+)
+
+// Executor describes who applies migrations, it's written to every row of migration_service_logs.
+type Executor struct {
+	EnvName string
+	// Host is a host or pod name
+	Host string
+	// Version and Commit are version and git commit of the migration service binary
+	Version string
+	Commit  string
+}
+
+// SetExecutor sets executor written to migration_service_logs.
+func (s *Set) SetExecutor(e Executor) {
+	s.executor = e
+}
+
+// newLog returns row of migration_service_logs for the migration, its attempt is taken from ctx.
+// err is an error the migration failed or was tolerated with.
+func (s *Set) newLog(ctx context.Context, name string, priority, ver int, mig Migration, status string, err error) migration_log.MigrationServicesLog {
+	a := attemptFromContext(ctx)
+	finishedAt := time.Now()
+	if a.number == 0 {
+		// skipped, faked and rolled back migrations are not executed by applyMigration
+		a = attempt{number: 1, startedAt: finishedAt}
+	}
+
+	sLog := migration_log.MigrationServicesLog{
+		MigrationServiceName: name,
+		Priority:             priority,
+		Version:              ver,
+		FileName:             filepath.Base(mig.Path),
+		SQL:                  mig.Query,
+		Hash:                 mig.Hash,
+		Status:               status,
+		Attempt:              a.number,
+		StartedAt:            a.startedAt,
+		FinishedAt:           finishedAt,
+		Duration:             finishedAt.Sub(a.startedAt),
+		EnvName:              s.executor.EnvName,
+		Host:                 s.executor.Host,
+		BinaryVersion:        s.executor.Version,
+		GitCommit:            s.executor.Commit,
+	}
+	if err != nil {
+		sLog.Error = err.Error()
+		sLog.SQLState = adapters.SQLState(err)
+	}
+	return sLog
+}
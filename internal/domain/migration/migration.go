@@ -3,19 +3,49 @@ package migration
 import (
 	"crypto/md5"
 	"fmt"
-	"strings"
+	"regexp"
 )
 
+// RepeatableVersion is version of repeatable migrations, they are stored in the set
+// and in migration_service_logs under it. Versions of files are never negative, so
+// a versioned file cannot take it.
+const RepeatableVersion = -1
+
+// repeatablePrefix marks repeatable migration files, e.g. R_users_view.sql
+const repeatablePrefix = "R_"
+
 // Migration is a single migration.
 type Migration struct {
 	AllowError bool
-	NoAuto     bool
+	// AllowErrors are SQLSTATE codes allow_error tolerates, empty means any error
+	AllowErrors []string
+	NoAuto      bool
+	// NoTransaction migrations are executed statement by statement outside of a transaction,
+	// required for CREATE INDEX CONCURRENTLY, VACUUM and friends
+	NoTransaction bool
+	// Repeatable migrations are applied after versioned ones of the service every time their hash changes,
+	// e.g. CREATE OR REPLACE of views and functions
+	Repeatable bool
 	EnvRegex   string
-	Path       string
-	Query      string
-	Hash       string
+	// DependsOn are migrations of other services which should be applied before this one
+	DependsOn   []Dependency
+	Description string
+	Tags        []string
+	// Timeouts of the migration, not zero ones override timeouts of the set
+	Timeouts Timeouts
+	// UnknownKeys are keys of the header which are not known directives
+	UnknownKeys []string
+	// HeaderErrors are invalid values and syntax errors of the header
+	HeaderErrors []string
+	Path         string
+	Query        string
+	Hash         string
+	// DownPath and DownQuery are set when migration has a paired <version>_<title>.down.sql file
+	DownPath  string
+	DownQuery string
 }
 
+// NewMigration returns migration of the query, directives are parsed from its header, see parseHeader.
 func NewMigration(query string, path string) Migration {
 	hash := fmt.Sprintf("%x", md5.Sum([]byte(query)))
 
@@ -27,31 +57,52 @@ func NewMigration(query string, path string) Migration {
 		Hash:       hash,
 	}
 
-	lines := strings.Split(query, "\n")
-	for _, line := range lines {
-		line = strings.Replace(line, "\t", "", -1)
-		// we don't have any comments at all
-		if len(line) < 2 || line[0:2] != "--" {
-			break
+	pairs, errs := parseHeader(query)
+	for _, err := range errs {
+		mig.HeaderErrors = append(mig.HeaderErrors, err.Error())
+	}
+	for _, pair := range pairs {
+		apply, ok := directives[pair.Key]
+		if !ok {
+			mig.UnknownKeys = append(mig.UnknownKeys, pair.Key)
+			continue
 		}
-		if len(line) > 15 && line[0:2] == "--" {
-			comment := line[2:]
-			comment = strings.Replace(comment, " ", "", -1)
-			comment = strings.Replace(comment, "-", "", -1)
-			pairs := strings.Split(comment, ",")
-			for _, pair := range pairs {
-				vals := strings.Split(pair, ":")
-				if vals[0] == "allow_error" {
-					if vals[1] == "true" || vals[1] == "1" {
-						mig.AllowError = true
-						break
-					}
-				} else if vals[0] == "required_env" {
-					mig.EnvRegex = strings.Trim(vals[1], " ")
-					break
-				}
-			}
+		if err := apply(&mig, pair.Value); err != nil {
+			mig.HeaderErrors = append(mig.HeaderErrors, pair.Key+": "+err.Error())
 		}
 	}
 	return mig
 }
+
+// Dependency is a depends_on target, zero Version means all migrations of the service.
+type Dependency struct {
+	Service string
+	Version int
+}
+
+func (d Dependency) String() string {
+	if d.Version == 0 {
+		return d.Service
+	}
+	return fmt.Sprintf("%s@%d", d.Service, d.Version)
+}
+
+// MatchEnv returns true if migration should be applied for envName according to required_env.
+func (m Migration) MatchEnv(envName string) (bool, error) {
+	if m.EnvRegex == "" {
+		return true, nil
+	}
+
+	envRegex := m.EnvRegex
+	doMatch := true
+	if envRegex[0] == '!' {
+		doMatch = false
+		envRegex = envRegex[1:]
+	}
+
+	regexRes, err := regexp.MatchString(envRegex, envName)
+	if err != nil {
+		return false, err
+	}
+	return regexRes == doMatch, nil
+}
@@ -0,0 +1,120 @@
+package migration
+
+import (
+	"context"
+	"sort"
+)
+
+// SetWorkers sets how many services of one priority ApplyAll applies concurrently,
+// every worker runs its migrations on its own connection of the repository pool.
+func (s *Set) SetWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	s.workers = n
+}
+
+// stepResult is a step executed by a worker.
+type stepResult struct {
+	st  *step
+	err error
+}
+
+// applyParallel applies priority buckets one after another, services of a bucket are applied
+// by workers concurrently while migrations of every service stay in schedule order.
+func (s *Set) applyParallel(ctx context.Context, sched schedule, curVersions map[string]int) (int, error) {
+	buckets := make(map[int][]*step)
+	priorities := make([]int, 0)
+	for _, st := range sched.steps {
+		for _, next := range st.next {
+			if next.priority < st.priority {
+				return 0, newLoadError(
+					ErrDependency, next.mig.Path, nil,
+					"depends on %s of a later priority folder, it is not supported by parallel apply", st,
+				)
+			}
+		}
+
+		if _, ok := buckets[st.priority]; !ok {
+			priorities = append(priorities, st.priority)
+		}
+		buckets[st.priority] = append(buckets[st.priority], st)
+		st.waiting = st.deps
+	}
+	sort.Ints(priorities)
+
+	n := 0
+	for _, priority := range priorities {
+		num, errs := s.applyBucket(ctx, buckets[priority], curVersions)
+		n += num
+		if len(errs) > 0 {
+			return n, &ApplyError{Errors: errs}
+		}
+	}
+	return n, nil
+}
+
+// applyBucket applies steps of one priority with up to s.workers concurrent services.
+// A failed step stops its service and steps which wait for it, other services go on.
+func (s *Set) applyBucket(ctx context.Context, steps []*step, curVersions map[string]int) (int, []ServiceError) {
+	results := make(chan stepResult)
+	ready := make([]*step, 0)
+	for _, st := range steps {
+		if st.waiting == 0 {
+			ready = append(ready, st)
+		}
+	}
+
+	n, running := 0, 0
+	done := make(map[*step]bool)
+	failed := make(map[string]error)
+	for len(ready) > 0 || running > 0 {
+		for running < s.workers && len(ready) > 0 {
+			var st *step
+			st, ready = popFirst(ready)
+			running++
+
+			curVersion := curVersions[st.service]
+			go func() {
+				results <- stepResult{st: st, err: s.applyMigration(ctx, st.service, st.priority, st.version, curVersion, st.mig)}
+			}()
+		}
+
+		res := <-results
+		running--
+		st := res.st
+		if res.err != nil {
+			s.log.Error().Err(res.err).Msgf("failed to apply migrations for %s", st.service)
+			failed[st.service] = res.err
+			continue
+		}
+
+		s.log.Info().Msgf("executed query \n%s\n for %s, version: %d, file: %s", st.mig.Query, st.service, st.version, st.mig.Path)
+		if st.version > curVersions[st.service] {
+			curVersions[st.service] = st.version
+		}
+		done[st] = true
+		n++
+
+		for _, next := range st.next {
+			next.waiting--
+			if next.waiting == 0 && next.priority == st.priority {
+				ready = append(ready, next)
+			}
+		}
+	}
+
+	// services which were not finished because they wait for failed ones
+	for _, st := range steps {
+		if _, ok := failed[st.service]; !ok && !done[st] {
+			failed[st.service] = newBlockedError(st)
+		}
+	}
+
+	errs := make([]ServiceError, 0, len(failed))
+	for service, err := range failed {
+		errs = append(errs, ServiceError{Service: service, Err: err})
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Service < errs[j].Service })
+	return n, errs
+}
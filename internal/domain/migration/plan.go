@@ -0,0 +1,198 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration_log"
+)
+
+// PlanFile is a migration file which would be executed or skipped by ApplyAll.
+type PlanFile struct {
+	Version       int      `json:"version"`
+	Path          string   `json:"path"`
+	RequiredEnv   string   `json:"required_env,omitempty"`
+	NoTransaction bool     `json:"no_transaction,omitempty"`
+	Repeatable    bool     `json:"repeatable,omitempty"`
+	Description   string   `json:"description,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+// ServicePlan describes what ApplyAll would do for a single service.
+type ServicePlan struct {
+	Priority       int        `json:"priority"`
+	Service        string     `json:"service"`
+	CurrentVersion int        `json:"current_version"`
+	Apply          []PlanFile `json:"apply"`
+	Skipped        []PlanFile `json:"skipped"`
+	ResultVersion  int        `json:"result_version"`
+}
+
+// Plan describes what ApplyAll would do, in the same order as ApplyAll does it.
+type Plan struct {
+	EnvName string `json:"env_name"`
+	// TransactionalDDL is false if DB commits DDL implicitly, so no migration is atomic
+	TransactionalDDL bool          `json:"transactional_ddl"`
+	Services         []ServicePlan `json:"services"`
+}
+
+// Plan goes through the schedule the same way ApplyAll does, but executes nothing.
+// Services are listed in execution order, a service is split in several parts if
+// it waits for migrations of other services in the middle.
+func (s *Set) Plan(ctx context.Context, skipVersionCheck bool, envName string) (Plan, error) {
+	plan := Plan{EnvName: envName, TransactionalDDL: s.repo.TransactionalDDL(), Services: make([]ServicePlan, 0)}
+
+	sched, err := s.schedule(withReadOnly(ctx), skipVersionCheck, envName)
+	if err != nil {
+		return plan, err
+	}
+
+	type serviceKey struct {
+		priority int
+		service  string
+	}
+	states := make(map[serviceKey]*serviceState)
+	curVersions := make(map[string]int)
+	for _, state := range sched.services {
+		states[serviceKey{state.priority, state.service}] = state
+		curVersions[state.service] = state.curVersion
+	}
+
+	// consecutive steps of the same service folder make a part
+	parts := make([]ServicePlan, 0)
+	planned := make(map[*serviceState]bool)
+	for _, st := range sched.steps {
+		if len(parts) == 0 || parts[len(parts)-1].Priority != st.priority || parts[len(parts)-1].Service != st.service {
+			state := states[serviceKey{st.priority, st.service}]
+			part := newServicePlan(state, curVersions[st.service])
+			if !planned[state] {
+				part.Skipped = state.skipped
+				planned[state] = true
+			}
+			parts = append(parts, part)
+		}
+
+		part := &parts[len(parts)-1]
+		part.Apply = append(part.Apply, planFile(st.version, st.mig))
+		if part.ResultVersion < st.version {
+			part.ResultVersion = st.version
+			curVersions[st.service] = st.version
+		}
+	}
+
+	// services with nothing to apply are listed by priority folders between the parts
+	i := 0
+	for _, state := range sched.services {
+		if planned[state] {
+			continue
+		}
+		for i < len(parts) && !state.less(parts[i].Priority, parts[i].Service) {
+			plan.Services = append(plan.Services, parts[i])
+			i++
+		}
+		sPlan := newServicePlan(state, state.curVersion)
+		sPlan.Skipped = state.skipped
+		plan.Services = append(plan.Services, sPlan)
+	}
+	plan.Services = append(plan.Services, parts[i:]...)
+
+	return plan, nil
+}
+
+func newServicePlan(state *serviceState, curVersion int) ServicePlan {
+	return ServicePlan{
+		Priority:       state.priority,
+		Service:        state.service,
+		CurrentVersion: curVersion,
+		Apply:          make([]PlanFile, 0),
+		Skipped:        make([]PlanFile, 0),
+		ResultVersion:  curVersion,
+	}
+}
+
+func planFile(ver int, mig Migration) PlanFile {
+	return PlanFile{
+		Version:       ver,
+		Path:          mig.Path,
+		RequiredEnv:   mig.EnvRegex,
+		NoTransaction: mig.NoTransaction,
+		Repeatable:    mig.Repeatable,
+		Description:   mig.Description,
+		Tags:          mig.Tags,
+	}
+}
+
+// Text returns human readable representation of the plan.
+func (p Plan) Text() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "env: %s\n", p.EnvName)
+	if !p.TransactionalDDL {
+		b.WriteString("warning: DB commits DDL implicitly, migrations are not atomic\n")
+	}
+	for _, sPlan := range p.Services {
+		fmt.Fprintf(&b, "\n[%d] %s: version %d -> %d\n", sPlan.Priority, sPlan.Service, sPlan.CurrentVersion, sPlan.ResultVersion)
+		if len(sPlan.Apply) == 0 && len(sPlan.Skipped) == 0 {
+			b.WriteString("  nothing to apply\n")
+		}
+		for _, file := range sPlan.Apply {
+			fmt.Fprintf(&b, "  apply %4s %s", file.versionText(), file.Path)
+			if file.NoTransaction {
+				b.WriteString(" (no transaction, not atomic)")
+			} else if !p.TransactionalDDL {
+				b.WriteString(" (not atomic)")
+			}
+			if file.Description != "" {
+				fmt.Fprintf(&b, " - %s", file.Description)
+			}
+			if len(file.Tags) > 0 {
+				fmt.Fprintf(&b, " [%s]", strings.Join(file.Tags, ", "))
+			}
+			b.WriteString("\n")
+		}
+		for _, file := range sPlan.Skipped {
+			fmt.Fprintf(&b, "  skip  %4s %s (required_env: %s)\n", file.versionText(), file.Path, file.RequiredEnv)
+		}
+	}
+
+	return b.String()
+}
+
+// versionText returns version of the file for Text, R for repeatable migrations.
+func (f PlanFile) versionText() string {
+	if f.Repeatable {
+		return "R"
+	}
+	return strconv.Itoa(f.Version)
+}
+
+type readOnlyCtxKey struct{}
+
+// withReadOnly returns ctx of a dry run, bookkeeping tables are read without being created or upgraded.
+func withReadOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readOnlyCtxKey{}, true)
+}
+
+func isReadOnly(ctx context.Context) bool {
+	readOnly, _ := ctx.Value(readOnlyCtxKey{}).(bool)
+	return readOnly
+}
+
+// serviceVersion returns current version of the service, a dry run reads missing tables as version 0.
+func (s *Set) serviceVersion(ctx context.Context, name string) (int, error) {
+	if isReadOnly(ctx) {
+		return adapters.ReaderOf(s.repo).GetServiceVersion(ctx, name)
+	}
+	return s.repo.GetServiceVersion(ctx, name)
+}
+
+// appliedHash returns hash of the last applied row of the migration, a dry run reads missing tables as empty hash.
+func (s *Set) appliedHash(ctx context.Context, sLog migration_log.MigrationServicesLog) (string, error) {
+	if isReadOnly(ctx) {
+		return adapters.ReaderOf(s.repo).GetHashFromMigrationServiceLog(ctx, sLog)
+	}
+	return s.repo.GetHashFromMigrationServiceLog(ctx, sLog)
+}
@@ -0,0 +1,77 @@
+package migration
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+)
+
+// Retry configures retries of migrations failed by transient errors,
+// like lock_timeout, serialization failures and deadlocks.
+type Retry struct {
+	// Retries is number of attempts after the first one, zero disables retries
+	Retries int
+	// Backoff is a pause before the first retry, it's doubled for every next one
+	Backoff time.Duration
+	// MaxBackoff limits the pause, zero means no limit
+	MaxBackoff time.Duration
+}
+
+// SetRetry sets retries of migrations failed by transient errors.
+func (s *Set) SetRetry(r Retry) {
+	s.retry = r
+}
+
+// attempt is an execution of a migration.
+type attempt struct {
+	number    int
+	startedAt time.Time
+}
+
+type attemptCtxKey struct{}
+
+// withAttempt returns ctx of the attempt of a migration.
+func withAttempt(ctx context.Context, a attempt) context.Context {
+	return context.WithValue(ctx, attemptCtxKey{}, a)
+}
+
+// attemptFromContext returns attempt set by withAttempt, or zero attempt for rows
+// which are written without executing migration, e.g. faked ones.
+func attemptFromContext(ctx context.Context) attempt {
+	a, _ := ctx.Value(attemptCtxKey{}).(attempt)
+	return a
+}
+
+// applyMigration applies migration and retries it while it fails by transient errors.
+// Every attempt is logged and written to migration_service_logs.
+func (s *Set) applyMigration(ctx context.Context, name string, priority, ver, curVersion int, mig Migration) error {
+	backoff := s.retry.Backoff
+	for n := 1; ; n++ {
+		err := s.applyAttempt(withAttempt(ctx, attempt{number: n, startedAt: time.Now()}), name, priority, ver, curVersion, mig)
+		if err == nil || !s.retryable(n, mig, err) {
+			return err
+		}
+
+		s.log.Warn().Err(err).Msgf(
+			"attempt %d of %d failed by transient error for %s, version: %d, file: %s, retrying in %s",
+			n, s.retry.Retries+1, name, ver, mig.Path, backoff,
+		)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+		if s.retry.MaxBackoff > 0 && backoff > s.retry.MaxBackoff {
+			backoff = s.retry.MaxBackoff
+		}
+	}
+}
+
+// retryable returns true if migration failed by a transient error can be applied again.
+// no_transaction migrations are not retried, statements before the failed one stay applied.
+func (s *Set) retryable(n int, mig Migration, err error) bool {
+	return n <= s.retry.Retries && !mig.NoTransaction && errors.Is(err, adapters.ErrTransient)
+}
@@ -0,0 +1,238 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// step is a migration scheduled by ApplyAll and Plan.
+type step struct {
+	priority int
+	service  string
+	version  int
+	mig      Migration
+	// next are steps waiting for this one, deps is number of steps this one waits for
+	// and waiting is how many of them are not done yet
+	next    []*step
+	deps    int
+	waiting int
+}
+
+func (st *step) String() string {
+	if st.mig.Repeatable {
+		return fmt.Sprintf("%s (%s)", st.service, st.mig.Path)
+	}
+	return fmt.Sprintf("%s@%d (%s)", st.service, st.version, st.mig.Path)
+}
+
+// less breaks ties between ready steps by (priority, service, version), repeatable migrations go last.
+func (st *step) less(o *step) bool {
+	if st.priority != o.priority {
+		return st.priority < o.priority
+	}
+	if st.service != o.service {
+		return st.service < o.service
+	}
+	if st.orderVersion() != o.orderVersion() {
+		return st.orderVersion() < o.orderVersion()
+	}
+	return st.mig.Path < o.mig.Path
+}
+
+func (st *step) orderVersion() int {
+	if st.mig.Repeatable {
+		return math.MaxInt
+	}
+	return st.version
+}
+
+// then makes next step wait for st.
+func (st *step) then(next *step) {
+	st.next = append(st.next, next)
+	next.deps++
+}
+
+// serviceState is a service of a priority folder before ApplyAll.
+type serviceState struct {
+	priority   int
+	service    string
+	curVersion int
+	// skipped are migrations with not matching required_env,
+	// skippedSteps are versioned ones of them to be logged as skipped
+	skipped      []PlanFile
+	skippedSteps []*step
+}
+
+func (st *serviceState) less(priority int, service string) bool {
+	if st.priority != priority {
+		return st.priority < priority
+	}
+	return st.service < service
+}
+
+// schedule is what ApplyAll executes: services sorted by (priority, service) and steps in execution order.
+type schedule struct {
+	services []*serviceState
+	steps    []*step
+}
+
+// schedule builds a graph of pending migrations, where every migration waits for previous versions of
+// its service and for its depends_on targets, and sorts it topologically.
+// Returns ErrDependency if a target does not exist or dependencies have a cycle.
+func (s *Set) schedule(ctx context.Context, skipVersionCheck bool, envName string) (schedule, error) {
+	var sched schedule
+	all := make([]*step, 0)
+	// pending are versioned steps of every service in version order
+	pending := make(map[string][]*step)
+	skipped := make(map[string]map[int]bool)
+	curVersions := make(map[string]int)
+	last := make(map[string]*step)
+
+	add := func(st *step) {
+		if prev, ok := last[st.service]; ok {
+			prev.then(st)
+		}
+		last[st.service] = st
+		all = append(all, st)
+	}
+
+	for _, priority := range s.priorities() {
+		for _, service := range s.services(priority) {
+			curVersion, err := s.serviceVersion(ctx, service)
+			if err != nil && priority > 0 && service != "migration" {
+				s.log.Error().Err(err).Msgf("failed to get service version for %s", service)
+				return sched, fmt.Errorf("failed to get service version for %s", service)
+			}
+
+			minVersion := -1
+			if !skipVersionCheck {
+				minVersion = curVersion
+			}
+
+			state := &serviceState{priority: priority, service: service, curVersion: curVersion, skipped: make([]PlanFile, 0)}
+			sched.services = append(sched.services, state)
+			curVersions[service] = curVersion
+			if skipped[service] == nil {
+				skipped[service] = make(map[int]bool)
+			}
+
+			migrations := s.serviceMigrations(service, priority, minVersion)
+			for _, ver := range sortedVersions(migrations) {
+				for _, mig := range migrations[ver] {
+					if match, err := mig.MatchEnv(envName); !match || err != nil {
+						s.log.Debug().Msgf("do not match selection with required_env: %s and %s", mig.EnvRegex, envName)
+						state.skipped = append(state.skipped, planFile(ver, mig))
+						state.skippedSteps = append(state.skippedSteps, &step{priority: priority, service: service, version: ver, mig: mig})
+						skipped[service][ver] = true
+						continue
+					}
+
+					st := &step{priority: priority, service: service, version: ver, mig: mig}
+					pending[service] = append(pending[service], st)
+					add(st)
+				}
+			}
+
+			for _, mig := range s.repeatableMigrations(service, priority) {
+				if match, err := mig.MatchEnv(envName); !match || err != nil {
+					state.skipped = append(state.skipped, planFile(RepeatableVersion, mig))
+					continue
+				}
+
+				changed, err := s.repeatableChanged(ctx, service, priority, mig)
+				if err != nil {
+					return sched, err
+				}
+				if changed {
+					add(&step{priority: priority, service: service, version: RepeatableVersion, mig: mig})
+				}
+			}
+		}
+	}
+
+	for _, st := range all {
+		for _, dep := range st.mig.DependsOn {
+			if _, ok := curVersions[dep.Service]; !ok {
+				return sched, newLoadError(ErrDependency, st.mig.Path, nil, "depends on unknown service %s", dep.Service)
+			}
+
+			target, found := dependencyTarget(pending[dep.Service], dep)
+			switch {
+			case found && target == st:
+				return sched, newLoadError(ErrDependency, st.mig.Path, nil, "depends on itself")
+			case found:
+				target.then(st)
+			case dep.Version > curVersions[dep.Service] && !skipped[dep.Service][dep.Version]:
+				return sched, newLoadError(ErrDependency, st.mig.Path, nil, "depends on %s which does not exist", dep)
+			}
+		}
+	}
+
+	// Kahn's algorithm, the smallest ready step goes first so without dependencies
+	// the order is the same as by priority folders
+	ready := make([]*step, 0)
+	for _, st := range all {
+		st.waiting = st.deps
+		if st.waiting == 0 {
+			ready = append(ready, st)
+		}
+	}
+	for len(ready) > 0 {
+		var st *step
+		st, ready = popFirst(ready)
+		sched.steps = append(sched.steps, st)
+
+		for _, next := range st.next {
+			next.waiting--
+			if next.waiting == 0 {
+				ready = append(ready, next)
+			}
+		}
+	}
+
+	if len(sched.steps) < len(all) {
+		blocked := make([]string, 0)
+		var first *step
+		for _, st := range all {
+			if st.waiting > 0 {
+				blocked = append(blocked, st.String())
+				if first == nil {
+					first = st
+				}
+			}
+		}
+		return sched, newLoadError(ErrDependency, first.mig.Path, nil, "dependency cycle, cannot order %s", strings.Join(blocked, ", "))
+	}
+
+	return sched, nil
+}
+
+// popFirst removes the smallest step from ready steps.
+func popFirst(ready []*step) (*step, []*step) {
+	i := 0
+	for j := range ready {
+		if ready[j].less(ready[i]) {
+			i = j
+		}
+	}
+	st := ready[i]
+	return st, append(ready[:i], ready[i+1:]...)
+}
+
+// dependencyTarget returns pending step dep waits for, the last one if dep does not have version.
+func dependencyTarget(pending []*step, dep Dependency) (*step, bool) {
+	if len(pending) == 0 {
+		return nil, false
+	}
+	if dep.Version == 0 {
+		return pending[len(pending)-1], true
+	}
+	for _, st := range pending {
+		if st.version == dep.Version {
+			return st, true
+		}
+	}
+	return nil, false
+}
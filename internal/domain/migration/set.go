@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
-	"regexp"
 	"sort"
 	"strings"
 	"sync"
@@ -20,15 +19,24 @@ type Set struct {
 	data map[int]map[string]map[int][]Migration
 	repo adapters.Repository
 	log  logger.Logger
+	// workers is number of services ApplyAll applies concurrently, see SetWorkers
+	workers int
+	// executor is written to migration_service_logs, see SetExecutor
+	executor Executor
+	// timeouts are default timeouts of migrations, see SetTimeouts
+	timeouts Timeouts
+	// retry configures retries of transient failures, see SetRetry
+	retry Retry
 	sync.Mutex
 }
 
 // New returns new instance of Set.
 func New(repo adapters.Repository) *Set {
 	return &Set{
-		data: make(map[int]map[string]map[int][]Migration),
-		repo: repo,
-		log:  logger.NewComponentLogger("migration", nil),
+		data:    make(map[int]map[string]map[int][]Migration),
+		repo:    repo,
+		log:     logger.NewComponentLogger("migration", nil),
+		workers: 1,
 	}
 }
 
@@ -46,9 +54,43 @@ func (s *Set) ServiceExists(name string) bool {
 	return false
 }
 
-// Add adds migration to the set.
-func (s *Set) Add(service string, priority, version int, mig Migration) {
+// ServicePriorities returns sorted priority folders of the service.
+func (s *Set) ServicePriorities(name string) []int {
+	priorities := make([]int, 0)
+	for _, priority := range s.priorities() {
+		if _, exists := s.data[priority][name]; exists {
+			priorities = append(priorities, priority)
+		}
+	}
+	return priorities
+}
+
+// versionPriority returns priority folder of the version of the service,
+// the lowest priority folder if the version is not found.
+func (s *Set) versionPriority(name string, ver int) int {
+	for _, priority := range s.priorities() {
+		if _, exists := s.data[priority][name][ver]; exists {
+			return priority
+		}
+	}
+	return s.servicePriority(name)
+}
+
+// servicePriority returns the lowest priority folder of the service.
+func (s *Set) servicePriority(name string) int {
+	for _, priority := range s.priorities() {
+		if _, exists := s.data[priority][name]; exists {
+			return priority
+		}
+	}
+	return 0
+}
+
+// Add adds migration to the set. Returns error if version of the service is already taken by another file,
+// adding the same file again is ignored. Repeatable migrations share RepeatableVersion.
+func (s *Set) Add(service string, priority, version int, mig Migration) error {
 	s.Lock()
+	defer s.Unlock()
 
 	priorityService, exists := s.data[priority]
 	if !exists {
@@ -60,19 +102,25 @@ func (s *Set) Add(service string, priority, version int, mig Migration) {
 		serviceMigrations = make(map[int][]Migration)
 	}
 
-	// ToDo
-	// Return error if version is already taken, no version duplications
 	versionMigrations, exists := serviceMigrations[version]
 	if !exists {
 		versionMigrations = make([]Migration, 0)
 	}
+	for _, taken := range versionMigrations {
+		if taken.Path == mig.Path {
+			return nil
+		}
+		if version != RepeatableVersion {
+			return newLoadError(ErrDuplicateVersion, mig.Path, nil, "version %d of service %s is already taken by %s", version, service, taken.Path)
+		}
+	}
 
 	versionMigrations = append(versionMigrations, mig)
 	serviceMigrations[version] = versionMigrations
 	priorityService[service] = serviceMigrations
 	s.data[priority] = priorityService
 
-	s.Unlock()
+	return nil
 }
 
 // Services returns list of services for given priority. If priority is -1, returns services for all priorities.
@@ -97,6 +145,7 @@ func (s *Set) services(priority int) []string {
 		}
 	}
 
+	sort.Strings(services)
 	return services
 }
 
@@ -120,7 +169,7 @@ func (s *Set) priorities() []int {
 
 }
 
-// serviceMigrations returns migrations for specified service with version > minVersion.
+// serviceMigrations returns versioned migrations for specified service with version > minVersion.
 func (s *Set) serviceMigrations(name string, priority, minVersion int) map[int][]Migration {
 	migrations := make(map[int][]Migration)
 	var priorities []int
@@ -147,7 +196,7 @@ func (s *Set) serviceMigrations(name string, priority, minVersion int) map[int][
 		}
 
 		for ver, m := range serviceMigrations {
-			if ver <= minVersion {
+			if ver <= minVersion || ver == RepeatableVersion {
 				continue
 			}
 
@@ -161,80 +210,238 @@ func (s *Set) serviceMigrations(name string, priority, minVersion int) map[int][
 	return migrations
 }
 
-// Apply applies migrations for specified service with version > minVersion.
-func (s *Set) Apply(name string, priority, minVersion, curVersion int, envName string) (int, int, error) {
-	migrations := s.serviceMigrations(name, priority, minVersion)
-
-	var n, lastVersion int
-	if len(migrations) == 0 {
-		return n, lastVersion, nil
-	}
+// repeatableMigrations returns repeatable migrations of specified service sorted by path.
+func (s *Set) repeatableMigrations(name string, priority int) []Migration {
+	s.Lock()
+	defer s.Unlock()
 
-	versions := make([]int, len(migrations))
+	migrations := append([]Migration{}, s.data[priority][name][RepeatableVersion]...)
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Path < migrations[j].Path })
+	return migrations
+}
 
-	i := 0
+// repeatableChanged returns true if hash of repeatable migration differs from the last one in migration_service_logs.
+func (s *Set) repeatableChanged(ctx context.Context, name string, priority int, mig Migration) (bool, error) {
+	sLog := migration_log.MigrationServicesLog{
+		MigrationServiceName: name,
+		Priority:             priority,
+		Version:              RepeatableVersion,
+		FileName:             filepath.Base(mig.Path),
+	}
+	hash, err := s.appliedHash(ctx, sLog)
+	if err != nil {
+		return false, errors.Wrapf(err, "cannot get hash of repeatable migration, file: %s", mig.Path)
+	}
+	return hash != mig.Hash, nil
+}
 
+// sortedVersions returns versions of migrations in ascending order.
+func sortedVersions(migrations map[int][]Migration) []int {
+	versions := make([]int, 0, len(migrations))
 	for ver := range migrations {
-		versions[i] = ver
-		i++
+		versions = append(versions, ver)
 	}
 	sort.Ints(versions)
+	return versions
+}
+
+// Apply applies migrations for specified service with version > minVersion,
+// then repeatable migrations of the service which were changed since the last run.
+func (s *Set) Apply(ctx context.Context, name string, priority, minVersion, curVersion int, envName string) (int, int, error) {
+	migrations := s.serviceMigrations(name, priority, minVersion)
 
-	for _, ver := range versions {
+	var n, lastVersion int
+	for _, ver := range sortedVersions(migrations) {
 		for _, mig := range migrations[ver] {
 
-			var err error
-			var regexRes bool
-			if mig.EnvRegex != "" {
-				doMatch := true
-				if mig.EnvRegex[0] == '!' {
-					doMatch = false
-					mig.EnvRegex = mig.EnvRegex[1:len(mig.EnvRegex)]
-				}
-				regexRes, err = regexp.MatchString(mig.EnvRegex, envName)
-				if regexRes == doMatch && err == nil {
-					err = s.repo.Exec(context.Background(), mig.Query)
-				} else {
-					s.log.Debug().Msgf("do not match selection with required_env: %s and %s", mig.EnvRegex, envName)
-					continue
-				}
-			} else {
-				err = s.repo.Exec(context.Background(), mig.Query)
+			match, err := mig.MatchEnv(envName)
+			if !match || err != nil {
+				s.log.Debug().Msgf("do not match selection with required_env: %s and %s", mig.EnvRegex, envName)
+				continue
 			}
 
-			if err != nil {
-				s.log.Error().Msgf("not executed query: \n%s\n for %s, version: %d, file: %s", mig.Query, name, ver, mig.Path)
-				if !mig.AllowError {
-					return n, lastVersion, errors.Wrapf(err, "migration(%d) query failed: %s, file: %s", ver, mig.Query, mig.Path)
-				}
+			if err = s.applyMigration(ctx, name, priority, ver, curVersion, mig); err != nil {
+				return n, lastVersion, err
 			}
 
-			if curVersion < ver {
-				if err = s.repo.UpdateServiceVersion(context.Background(), name, ver); err != nil {
-					return n, lastVersion, errors.Wrapf(err, "cannot update migration_services, ver: %d, file: %s", ver, mig.Path)
-				}
+			s.log.Info().Msgf("executed query \n%s\n for %s, version: %d, file: %s", mig.Query, name, ver, mig.Path)
+		}
+
+		lastVersion = ver
+		n++
+	}
+
+	for _, mig := range s.repeatableMigrations(name, priority) {
+		if match, err := mig.MatchEnv(envName); !match || err != nil {
+			s.log.Debug().Msgf("do not match selection with required_env: %s and %s", mig.EnvRegex, envName)
+			continue
+		}
+
+		changed, err := s.repeatableChanged(ctx, name, priority, mig)
+		if err != nil {
+			return n, lastVersion, err
+		}
+		if !changed {
+			continue
+		}
+
+		if err = s.applyMigration(ctx, name, priority, RepeatableVersion, curVersion, mig); err != nil {
+			return n, lastVersion, err
+		}
+
+		s.log.Info().Msgf("executed repeatable query \n%s\n for %s, file: %s", mig.Query, name, mig.Path)
+		n++
+	}
+
+	return n, lastVersion, nil
+}
+
+// execMigration executes migration, bumps service version and writes migration_service_logs in one unit of work.
+func (s *Set) execMigration(ctx context.Context, name string, priority, ver, curVersion int, mig Migration) error {
+	ctx = adapters.WithFile(ctx, mig.Path)
+	if mig.NoTransaction {
+		return s.applyMigrationNoTx(ctx, name, priority, ver, curVersion, mig)
+	}
+
+	if !s.repo.TransactionalDDL() {
+		s.log.Warn().Msgf(
+			"migration is NOT atomic, DB commits DDL implicitly, failed migration can stay partially applied for %s, version: %d, file: %s",
+			name, ver, mig.Path,
+		)
+	}
+
+	return s.repo.BeginFunc(ctx, func(tx adapters.Tx) error {
+		err := tx.Exec(ctx, mig.Query)
+		if err != nil {
+			s.log.Error().Err(err).Str("sqlstate", adapters.SQLState(err)).Msgf("not executed query: \n%s\n for %s, version: %d, file: %s", mig.Query, name, ver, mig.Path)
+			if !mig.tolerates(ctx, err) {
+				return errors.Wrapf(err, "migration(%d) query failed, file: %s", ver, mig.Path)
 			}
+		}
 
-			sLog := migration_log.MigrationServicesLog{
-				MigrationServiceName: name,
-				Priority:             priority,
-				Version:              ver,
-				FileName:             filepath.Base(mig.Path),
-				SQL:                  mig.Query,
-				Hash:                 mig.Hash,
+		return s.writeBookkeeping(ctx, tx, name, priority, ver, curVersion, mig, err)
+	})
+}
+
+// applyMigrationNoTx executes no_transaction migration statement by statement outside of a transaction,
+// all statements run on one connection. Such migration is not atomic: if one of the statements fails,
+// previous ones stay applied.
+func (s *Set) applyMigrationNoTx(ctx context.Context, name string, priority, ver, curVersion int, mig Migration) error {
+	s.log.Warn().Msgf(
+		"migration is NOT atomic, executing %d statements one by one outside of a transaction for %s, version: %d, file: %s",
+		len(ParseStatements(mig.Query)), name, ver, mig.Path,
+	)
+
+	var tolerated error
+	if err := s.repo.ExecNoTx(ctx, mig.Query); err != nil {
+		s.log.Error().Err(err).Str("sqlstate", adapters.SQLState(err)).Msgf(
+			"not executed no_transaction query for %s, version: %d, file: %s, previous statements stay applied",
+			name, ver, mig.Path,
+		)
+		if !mig.tolerates(ctx, err) {
+			return errors.Wrapf(err, "migration(%d) failed", ver)
+		}
+		tolerated = err
+	}
+
+	return s.repo.BeginFunc(ctx, func(tx adapters.Tx) error {
+		return s.writeBookkeeping(ctx, tx, name, priority, ver, curVersion, mig, tolerated)
+	})
+}
+
+// writeBookkeeping bumps service version and writes migration_service_logs for executed migration,
+// error tolerated by allow_error is logged with StatusTolerated.
+func (s *Set) writeBookkeeping(ctx context.Context, tx adapters.Tx, name string, priority, ver, curVersion int, mig Migration, tolerated error) error {
+	if ver != RepeatableVersion && curVersion < ver {
+		if err := tx.UpdateServiceVersion(ctx, name, ver); err != nil {
+			return errors.Wrapf(err, "cannot update migration_services, ver: %d, file: %s", ver, mig.Path)
+		}
+	}
+
+	status := migration_log.StatusApplied
+	if tolerated != nil {
+		status = migration_log.StatusTolerated
+	}
+	sLog := s.newLog(ctx, name, priority, ver, mig, status, tolerated)
+	if err := tx.WriteMigrationServiceLog(ctx, sLog); err != nil {
+		return errors.Wrap(err, "cannot update migration_service_logs")
+	}
+	return nil
+}
+
+// Rollback runs down migrations for specified service with targetVersion < version <= curVersion
+// in reverse version order and lowers service version after every rolled back version.
+func (s *Set) Rollback(ctx context.Context, name string, targetVersion, curVersion int, envName string) (int, error) {
+	migrations := s.serviceMigrations(name, -1, targetVersion)
+
+	versions := make([]int, 0, len(migrations))
+	for ver, migs := range migrations {
+		if ver > curVersion {
+			continue
+		}
+		// check all down scripts first, we don't want to stop in the middle of rollback
+		for _, mig := range migs {
+			if match, err := mig.MatchEnv(envName); !match || err != nil {
+				continue
 			}
-			if err = s.repo.WriteMigrationServiceLog(context.Background(), sLog); err != nil {
-				return n, lastVersion, errors.Wrap(err, "cannot update migration_service_logs")
+			if mig.DownQuery == "" {
+				return 0, fmt.Errorf("migration(%d) does not have down script, file: %s", ver, mig.Path)
 			}
-
-			s.log.Info().Msgf("executed query \n%s\n for %s, version: %d, file: %s", mig.Query, name, ver, mig.Path)
 		}
+		versions = append(versions, ver)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
 
-		lastVersion = ver
+	n := 0
+	for i, ver := range versions {
+		prevVersion := targetVersion
+		if i+1 < len(versions) {
+			prevVersion = versions[i+1]
+		}
+		if err := s.rollbackVersion(ctx, name, ver, prevVersion, migrations[ver], envName); err != nil {
+			return n, err
+		}
 		n++
 	}
 
-	return n, lastVersion, nil
+	return n, nil
+}
+
+// rollbackVersion runs down scripts of a version, lowers service version to prevVersion
+// and marks migration_service_logs rows as rolled back in one unit of work, every rolled back file
+// is also logged with StatusRolledBack.
+func (s *Set) rollbackVersion(ctx context.Context, name string, ver, prevVersion int, migs []Migration, envName string) error {
+	priority := s.versionPriority(name, ver)
+	return s.repo.BeginFunc(ctx, func(tx adapters.Tx) error {
+		for j := len(migs) - 1; j >= 0; j-- {
+			mig := migs[j]
+			if match, err := mig.MatchEnv(envName); !match || err != nil {
+				s.log.Debug().Msgf("do not match selection with required_env: %s and %s", mig.EnvRegex, envName)
+				continue
+			}
+
+			if err := tx.Exec(adapters.WithFile(ctx, mig.DownPath), mig.DownQuery); err != nil {
+				s.log.Error().Msgf("not executed down query: \n%s\n for %s, version: %d, file: %s", mig.DownQuery, name, ver, mig.DownPath)
+				return errors.Wrapf(err, "migration(%d) down query failed: %s, file: %s", ver, mig.DownQuery, mig.DownPath)
+			}
+
+			sLog := s.newLog(ctx, name, priority, ver, mig, migration_log.StatusRolledBack, nil)
+			if err := tx.MarkMigrationServiceLogRolledBack(ctx, sLog); err != nil {
+				return errors.Wrap(err, "cannot update migration_service_logs")
+			}
+			sLog.SQL = mig.DownQuery
+			if err := tx.WriteMigrationServiceLog(ctx, sLog); err != nil {
+				return errors.Wrap(err, "cannot update migration_service_logs")
+			}
+
+			s.log.Info().Msgf("executed down query \n%s\n for %s, version: %d, file: %s", mig.DownQuery, name, ver, mig.DownPath)
+		}
+
+		if err := tx.UpdateServiceVersion(ctx, name, prevVersion); err != nil {
+			return errors.Wrapf(err, "cannot update migration_services, ver: %d", prevVersion)
+		}
+		return nil
+	})
 }
 
 // GetSQL returns SQL statement for specified service with version > minVersion.
@@ -245,18 +452,7 @@ func (s *Set) GetSQL(name string, priority int, minVersion int) (sql string, err
 		return
 	}
 
-	versions := make([]int, len(migrations))
-
-	i := 0
-
-	for ver := range migrations {
-		versions[i] = ver
-
-		i++
-	}
-	sort.Ints(versions)
-
-	for _, ver := range versions {
+	for _, ver := range sortedVersions(migrations) {
 		for _, mig := range migrations[ver] {
 			sql += "\n" + strings.TrimSpace(mig.Query)
 			if sql[len(sql)-1:] != ";" {
@@ -268,56 +464,85 @@ func (s *Set) GetSQL(name string, priority int, minVersion int) (sql string, err
 	return sql, nil
 }
 
-// ApplyAll applies all migrations for all services.
-func (s *Set) ApplyAll(skipVersionCheck bool, envVersion string) (int, error) {
-	var (
-		n, ver, minVersion, curVersion int
-		err                            error
-	)
-	lastVersions := make(map[string]int)
-
-	pariorities := s.priorities()
-	for _, priority := range pariorities {
-		services := s.services(priority)
-		for _, service := range services {
-			minVersion = -1
-			curVersion, err = s.repo.GetServiceVersion(context.Background(), service)
-
-			if err != nil && priority > 0 && service != "migration" {
-				s.log.Error().Err(err).Msgf("failed to get service version for %s", service)
-				return n, fmt.Errorf("failed to get service version for %s", service)
-			}
+// ApplyAll applies all migrations for all services in order of schedule:
+// by priority folders and after migrations they depends_on.
+// With several workers services of one priority are applied concurrently and
+// errors of all failed services are returned as ApplyError.
+func (s *Set) ApplyAll(ctx context.Context, skipVersionCheck bool, envVersion string) (int, error) {
+	sched, err := s.schedule(ctx, skipVersionCheck, envVersion)
+	if err != nil {
+		s.log.Error().Err(err).Msg("failed to schedule migrations")
+		return 0, err
+	}
 
-			if !skipVersionCheck {
-				minVersion = curVersion
-			}
+	curVersions := make(map[string]int)
+	for _, state := range sched.services {
+		curVersions[state.service] = state.curVersion
+	}
 
-			num, lastVersion, err := s.Apply(service, priority, minVersion, curVersion, envVersion)
-			if err != nil {
-				s.log.Error().Err(err).Msgf("failed to apply migrations for %s", service)
-				return n, fmt.Errorf("failed to apply migrations for %s", service)
-			}
+	var n int
+	if s.workers > 1 {
+		n, err = s.applyParallel(ctx, sched, curVersions)
+	} else {
+		n, err = s.applySequential(ctx, sched, curVersions)
+	}
+	if logErr := s.logSkipped(ctx, sched, curVersions); logErr != nil && err == nil {
+		err = logErr
+	}
+	return n, err
+}
 
-			n += num
-			if lastVersion > ver {
-				if curLastVersion, ok := lastVersions[service]; !ok || lastVersion > curLastVersion {
-					lastVersions[service] = lastVersion
-				}
-			}
+// applySequential applies steps of the schedule one by one, it stops on the first error.
+func (s *Set) applySequential(ctx context.Context, sched schedule, curVersions map[string]int) (int, error) {
+	n := 0
+	for _, st := range sched.steps {
+		if err := s.applyMigration(ctx, st.service, st.priority, st.version, curVersions[st.service], st.mig); err != nil {
+			s.log.Error().Err(err).Msgf("failed to apply migrations for %s", st.service)
+			return n, errors.Wrapf(err, "failed to apply migrations for %s", st.service)
+		}
+		s.log.Info().Msgf("executed query \n%s\n for %s, version: %d, file: %s", st.mig.Query, st.service, st.version, st.mig.Path)
+
+		if st.version > curVersions[st.service] {
+			curVersions[st.service] = st.version
 		}
+		n++
 	}
 
 	return n, nil
 }
 
-// FakeAll marked all migrations as finished without applying them
-func (s *Set) FakeAll() (int, error) {
+// logSkipped writes migrations skipped by required_env to migration_service_logs
+// once the service version moved past them, so they are never applied later.
+func (s *Set) logSkipped(ctx context.Context, sched schedule, curVersions map[string]int) error {
+	for _, state := range sched.services {
+		for _, st := range state.skippedSteps {
+			if st.version <= state.curVersion || st.version > curVersions[st.service] {
+				continue
+			}
+			sLog := s.newLog(ctx, st.service, st.priority, st.version, st.mig, migration_log.StatusSkipped, nil)
+			if err := s.repo.WriteMigrationServiceLog(ctx, sLog); err != nil {
+				return errors.Wrapf(err, "cannot update migration_service_logs, file: %s", st.mig.Path)
+			}
+		}
+	}
+	return nil
+}
+
+// FakeAll marked all migrations as finished without applying them, they are written to migration_service_logs
+// as faked, so hashes of repeatable migrations are not applied on the next run.
+func (s *Set) FakeAll(ctx context.Context) (int, error) {
 	servicesWithLastVersion := make(map[string]int)
 	n := 0
 
 	for priority := range s.data {
 		for name, service := range s.data[priority] {
-			for ver := range service {
+			for ver, migrationList := range service {
+				if ver == RepeatableVersion {
+					if err := s.fakeRepeatable(ctx, name, priority, migrationList); err != nil {
+						return n, err
+					}
+					continue
+				}
 				if ver >= servicesWithLastVersion[name] {
 					servicesWithLastVersion[name] = ver
 				}
@@ -326,16 +551,19 @@ func (s *Set) FakeAll() (int, error) {
 	}
 
 	for name, version := range servicesWithLastVersion {
-		curVersion, err := s.repo.GetServiceVersion(context.Background(), name)
+		curVersion, err := s.repo.GetServiceVersion(ctx, name)
 		if err != nil && name != "migration" {
 			s.log.Error().Err(err).Msgf("failed to get service version for %s", name)
 			return n, fmt.Errorf("failed to get service version for %s", name)
 		}
 
 		if curVersion < version {
-			if err := s.repo.UpdateServiceVersion(context.Background(), name, version); err != nil {
+			if err := s.repo.UpdateServiceVersion(ctx, name, version); err != nil {
 				return n, errors.Wrapf(err, "cannot update migration_services %s, ver: %d", name, version)
 			}
+			if err := s.fakeVersions(ctx, name, curVersion); err != nil {
+				return n, err
+			}
 		}
 		n++
 	}
@@ -343,8 +571,35 @@ func (s *Set) FakeAll() (int, error) {
 	return n, nil
 }
 
-// CheckMigrationHash verifies if all hashes of migrations are equal to those in migration table
-func (s *Set) CheckMigrationHash() (allEqual bool, list []string, err error) {
+// fakeVersions writes migrations of the service with version > curVersion to migration_service_logs as faked.
+func (s *Set) fakeVersions(ctx context.Context, name string, curVersion int) error {
+	migrations := s.serviceMigrations(name, -1, curVersion)
+	for _, ver := range sortedVersions(migrations) {
+		priority := s.versionPriority(name, ver)
+		for _, mig := range migrations[ver] {
+			sLog := s.newLog(ctx, name, priority, ver, mig, migration_log.StatusFaked, nil)
+			if err := s.repo.WriteMigrationServiceLog(ctx, sLog); err != nil {
+				return errors.Wrapf(err, "cannot update migration_service_logs, file: %s", mig.Path)
+			}
+		}
+	}
+	return nil
+}
+
+// fakeRepeatable writes hashes of repeatable migrations to migration_service_logs without applying them.
+func (s *Set) fakeRepeatable(ctx context.Context, name string, priority int, migs []Migration) error {
+	for _, mig := range migs {
+		sLog := s.newLog(ctx, name, priority, RepeatableVersion, mig, migration_log.StatusFaked, nil)
+		if err := s.repo.WriteMigrationServiceLog(ctx, sLog); err != nil {
+			return errors.Wrapf(err, "cannot update migration_service_logs, file: %s", mig.Path)
+		}
+	}
+	return nil
+}
+
+// CheckMigrationHash verifies if all hashes of migrations are equal to those in migration table,
+// repeatable migrations are skipped since they are expected to change
+func (s *Set) CheckMigrationHash(ctx context.Context) (allEqual bool, list []string, err error) {
 	var hash string
 
 	allEqual = true
@@ -352,6 +607,9 @@ func (s *Set) CheckMigrationHash() (allEqual bool, list []string, err error) {
 	for priority := range s.data {
 		for name, service := range s.data[priority] {
 			for ver, migrationList := range service {
+				if ver == RepeatableVersion {
+					continue
+				}
 				for _, migration := range migrationList {
 					sLog := migration_log.MigrationServicesLog{
 						MigrationServiceName: name,
@@ -359,7 +617,7 @@ func (s *Set) CheckMigrationHash() (allEqual bool, list []string, err error) {
 						Version:              ver,
 						FileName:             filepath.Base(migration.Path),
 					}
-					hash, err = s.repo.GetHashFromMigrationServiceLog(context.Background(), sLog)
+					hash, err = s.repo.GetHashFromMigrationServiceLog(ctx, sLog)
 					if err != nil {
 						return false, nil, err
 					}
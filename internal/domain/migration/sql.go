@@ -1,8 +1,9 @@
 package migration
 
 import (
-	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -10,106 +11,154 @@ import (
 	"github.com/pkg/errors"
 )
 
+const downExt = ".down.sql"
+
 type migrationStats struct {
 	ServicePriority   int
 	ServiceName       string
 	MigrationPriority int
 }
 
-// ReadDir reads migrations from all sql files in the dir.
+// ReadDir reads migrations from all sql files in the dir on disk.
 func ReadDir(rootDir, subDir string, set *Set) error {
-	files, err := os.ReadDir(filepath.Join(rootDir, subDir))
+	return readFS(os.DirFS(rootDir), filepath.ToSlash(subDir), rootDir, set)
+}
+
+// ReadFS reads migrations from all sql files in the dir of fsys, e.g. of embed.FS.
+// Paths of migrations are fsys paths, so dir should contain <priority>_<service> folders.
+func ReadFS(fsys fs.FS, dir string, set *Set) error {
+	return readFS(fsys, dir, "", set)
+}
+
+// readFS reads migrations from dir of fsys, rootDir is prepended to paths of migrations
+// read from disk, so they look the same in logs as before.
+func readFS(fsys fs.FS, dir, rootDir string, set *Set) error {
+	if dir == "" {
+		dir = "."
+	}
+	files, err := fs.ReadDir(fsys, dir)
 	if err != nil {
-		return errors.Wrap(err, "failed to read directory")
+		return newLoadError(ErrUnreadable, displayPath(dir, rootDir), err, "failed to read directory")
 	}
 
 	for _, f := range files {
+		name := path.Join(dir, f.Name())
 		if f.IsDir() {
-			if err := ReadDir(rootDir, filepath.Join(subDir, f.Name()), set); err != nil {
+			if err := readFS(fsys, name, rootDir, set); err != nil {
 				return err
 			}
 			continue
 		}
 
-		if filepath.Ext(f.Name()) != ".sql" {
+		// down files are read together with their up files
+		if path.Ext(f.Name()) != ".sql" || isDownFile(f.Name()) {
 			continue
 		}
 
-		fullPath := filepath.Join(rootDir, subDir, f.Name())
-		stats, err := getMigrationInfo(fullPath)
-		if err != nil {
+		if err := readMigration(fsys, name, displayPath(name, rootDir), set); err != nil {
 			return err
 		}
-
-		/* #nosec */
-		file, err := os.ReadFile(fullPath)
-		if err != nil {
-			return errors.Wrapf(err, "failed to open file %s", fullPath)
-		}
-
-		m := NewMigration(string(file), fullPath)
-		set.Add(stats.ServiceName, stats.ServicePriority, stats.MigrationPriority, m)
 	}
 
 	return nil
 }
 
+// displayPath returns path of fsys file, rootDir is prepended for files read from disk.
+func displayPath(name, rootDir string) string {
+	if rootDir == "" {
+		return name
+	}
+	return filepath.Join(rootDir, filepath.FromSlash(name))
+}
+
 // ReadFile reads migrations from file
-func ReadFile(path string, set *Set) error {
-	if filepath.Ext(path) != ".sql" {
+func ReadFile(filePath string, set *Set) error {
+	if filepath.Ext(filePath) != ".sql" || isDownFile(filePath) {
 		return nil
 	}
 
-	stats, err := getMigrationInfo(path)
+	return readMigration(os.DirFS(filepath.Dir(filePath)), filepath.Base(filePath), filePath, set)
+}
+
+// readMigration reads migration from name file of fsys, fullPath is used as path of the migration.
+func readMigration(fsys fs.FS, name, fullPath string, set *Set) error {
+	stats, err := getMigrationInfo(filepath.ToSlash(fullPath))
 	if err != nil {
 		return err
 	}
 
-	/* #nosec */
-	file, err := os.ReadFile(path)
+	file, err := fs.ReadFile(fsys, name)
 	if err != nil {
-		return errors.Wrapf(err, "failed to open file %s", path)
+		return newLoadError(ErrUnreadable, fullPath, err, "failed to open file")
 	}
 
-	m := NewMigration(string(file), path)
-	set.Add(stats.ServiceName, stats.ServicePriority, stats.MigrationPriority, m)
+	m := NewMigration(string(file), fullPath)
+	if strings.HasPrefix(path.Base(name), repeatablePrefix) {
+		m.Repeatable = true
+	}
+	if m.Repeatable {
+		stats.MigrationPriority = RepeatableVersion
+	}
 
-	return nil
+	downName := strings.TrimSuffix(name, ".sql") + downExt
+	downPath := strings.TrimSuffix(fullPath, ".sql") + downExt
+	downFile, err := fs.ReadFile(fsys, downName)
+	if err == nil {
+		m.DownPath = downPath
+		m.DownQuery = string(downFile)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return newLoadError(ErrUnreadable, downPath, err, "failed to open file")
+	}
+
+	return set.Add(stats.ServiceName, stats.ServicePriority, stats.MigrationPriority, m)
 }
 
-func getMigrationInfo(path string) (migrationStats, error) {
+// isDownFile returns true for <version>_<title>.down.sql files
+func isDownFile(name string) bool {
+	return strings.HasSuffix(name, downExt)
+}
+
+// getMigrationInfo parses priorities and service name from slash separated path of the migration.
+func getMigrationInfo(filePath string) (migrationStats, error) {
 	var stats migrationStats
-	fileName := filepath.Base(path)
+	fileName := path.Base(filePath)
 
-	if parts := strings.Split(fileName, "_"); len(parts) > 1 {
-		if p, err := strconv.Atoi(parts[0]); err == nil {
-			stats.MigrationPriority = p
-		} else {
-			return stats, errors.Wrapf(err, "cannot parse %s", fileName)
+	if strings.HasPrefix(fileName, repeatablePrefix) {
+		stats.MigrationPriority = RepeatableVersion
+	} else if parts := strings.Split(fileName, "_"); len(parts) > 1 {
+		p, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return stats, newLoadError(ErrBadFileName, filePath, err, "version should be a number")
 		}
+		if p < 0 {
+			return stats, newLoadError(ErrBadFileName, filePath, nil, "version should not be negative")
+		}
+		stats.MigrationPriority = p
 	} else {
-		return stats, fmt.Errorf(
-			"file %s does not have correct format <sql_index>_filename.sql, dont know how to parse",
-			path,
-		)
+		return stats, newLoadError(ErrBadFileName, filePath, nil, "file should have <sql_index>_filename.sql format")
 	}
 
 	serviceSubFolder := ""
-	pathParts := strings.Split(path, "/")
+	pathParts := strings.Split(filePath, "/")
+	if len(pathParts) < 2 {
+		return stats, newLoadError(ErrBadServiceFolder, filePath, nil, "file should be in <service_index>_<service_name> folder")
+	}
 	serviceFolder := pathParts[len(pathParts)-2]
-	if !strings.Contains(serviceFolder, "_") {
+	if !strings.Contains(serviceFolder, "_") && len(pathParts) > 2 {
 		serviceSubFolder = "_" + serviceFolder
 		serviceFolder = pathParts[len(pathParts)-3]
 	}
 
 	if parts := strings.Split(serviceFolder, "_"); len(parts) > 1 {
+		// not numeric service index is read as priority 0, like it always was, --validate warns about it
 		if p, err := strconv.Atoi(parts[0]); err == nil {
 			stats.ServicePriority = p
 		}
 		stats.ServiceName = serviceFolder[len(parts[0])+1:] + serviceSubFolder
 	} else {
-		return stats, fmt.Errorf(
-			"folder %s does not have correct format <service_index>_<service_name>, please update file name to have index and name",
+		return stats, newLoadError(
+			ErrBadServiceFolder, filePath, nil,
+			"folder %s does not have correct format <service_index>_<service_name>, please update folder name to have index and name",
 			serviceFolder,
 		)
 	}
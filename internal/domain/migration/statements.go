@@ -0,0 +1,212 @@
+package migration
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Statement is a SQL statement of a query with its position in the query.
+type Statement struct {
+	SQL string
+	// Offset is a byte offset of the statement in the query
+	Offset int
+	// Line and Column are 1-based position of the statement in the query, column is counted in characters
+	Line   int
+	Column int
+}
+
+// SplitStatements splits query into separate SQL statements by top level semicolons, see ParseStatements.
+func SplitStatements(query string) []string {
+	statements := ParseStatements(query)
+	sqls := make([]string, len(statements))
+	for i, statement := range statements {
+		sqls[i] = statement.SQL
+	}
+	return sqls
+}
+
+// ParseStatements splits query into separate SQL statements by top level semicolons.
+// It understands string literals, quoted identifiers, dollar-quoted bodies, comments and
+// BEGIN ATOMIC ... END bodies of SQL functions, so semicolons inside of them do not split statements.
+// Statements without SQL code (only spaces or comments) are dropped.
+func ParseStatements(query string) []Statement {
+	statements := make([]Statement, 0)
+	start := 0
+	hasCode := false
+	// depth is nesting of BEGIN ATOMIC bodies and CASE expressions inside of them, both end with END
+	depth := 0
+
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			i = skipLineComment(query, i)
+			continue
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			i = skipBlockComment(query, i)
+			continue
+		case c == '\'':
+			// E'...' strings allow backslash escapes
+			escapes := i > 0 && (query[i-1] == 'E' || query[i-1] == 'e') && (i == 1 || !isIdentChar(query[i-2]))
+			i = skipQuoted(query, i, '\'', escapes)
+		case c == '"':
+			i = skipQuoted(query, i, '"', false)
+		case c == '$':
+			if tag, ok := dollarTag(query, i); ok {
+				end := strings.Index(query[i+len(tag):], tag)
+				if end < 0 {
+					i = len(query)
+				} else {
+					i += len(tag) + end + len(tag)
+				}
+			} else {
+				i++
+			}
+		case isIdentChar(c) && c != '$' && (i == 0 || !isIdentChar(query[i-1])):
+			end := wordEnd(query, i)
+			switch word := strings.ToLower(query[i:end]); {
+			case word == "begin" && isAtomic(query, end):
+				depth++
+			case word == "case" && depth > 0:
+				depth++
+			case word == "end" && depth > 0:
+				depth--
+			}
+			i = end
+		case c == ';' && depth > 0:
+			i++
+		case c == ';':
+			if hasCode {
+				statements = append(statements, newStatement(query, start, i+1))
+			}
+			i++
+			start = i
+			hasCode = false
+			continue
+		default:
+			i++
+		}
+		if !unicode.IsSpace(rune(c)) {
+			hasCode = true
+		}
+	}
+
+	if hasCode {
+		statements = append(statements, newStatement(query, start, len(query)))
+	}
+
+	return statements
+}
+
+// newStatement returns statement of query[start:end] without surrounding spaces.
+func newStatement(query string, start, end int) Statement {
+	sql := strings.TrimRightFunc(query[start:end], unicode.IsSpace)
+	trimmed := strings.TrimLeftFunc(sql, unicode.IsSpace)
+	offset := start + len(sql) - len(trimmed)
+	line, column := Position(query, offset)
+	return Statement{SQL: trimmed, Offset: offset, Line: line, Column: column}
+}
+
+// Position returns 1-based line and column of byte offset in query, column is counted in characters.
+func Position(query string, offset int) (int, int) {
+	if offset > len(query) {
+		offset = len(query)
+	}
+	before := query[:offset]
+	line := strings.Count(before, "\n") + 1
+	lineStart := strings.LastIndexByte(before, '\n') + 1
+	return line, utf8.RuneCountInString(before[lineStart:]) + 1
+}
+
+// skipLineComment returns position right after the end of -- comment started at i.
+func skipLineComment(query string, i int) int {
+	end := strings.IndexByte(query[i:], '\n')
+	if end < 0 {
+		return len(query)
+	}
+	return i + end + 1
+}
+
+// skipBlockComment returns position right after the end of /* */ comment started at i, comments can be nested.
+func skipBlockComment(query string, i int) int {
+	depth := 0
+	for i < len(query) {
+		switch {
+		case strings.HasPrefix(query[i:], "/*"):
+			depth++
+			i += 2
+		case strings.HasPrefix(query[i:], "*/"):
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+	return i
+}
+
+// skipQuoted returns position right after the closing quote of literal started at i.
+// Doubled quote is an escaped quote, backslash escapes only when escapes is true.
+func skipQuoted(query string, i int, quote byte, escapes bool) int {
+	i++
+	for i < len(query) {
+		switch query[i] {
+		case '\\':
+			if escapes {
+				i += 2
+				continue
+			}
+		case quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i += 2
+				continue
+			}
+			return i + 1
+		}
+		i++
+	}
+	return i
+}
+
+// wordEnd returns position right after the identifier or keyword started at i.
+func wordEnd(query string, i int) int {
+	for i < len(query) && isIdentChar(query[i]) {
+		i++
+	}
+	return i
+}
+
+// isAtomic returns true if ATOMIC keyword follows position i, so BEGIN before it starts a function body.
+func isAtomic(query string, i int) bool {
+	for i < len(query) && unicode.IsSpace(rune(query[i])) {
+		i++
+	}
+	end := wordEnd(query, i)
+	return strings.EqualFold(query[i:end], "atomic")
+}
+
+// dollarTag returns $tag$ started at i, if any.
+func dollarTag(query string, i int) (string, bool) {
+	// $1 is a parameter and a$b is an identifier, not a dollar quote
+	if i > 0 && isIdentChar(query[i-1]) {
+		return "", false
+	}
+	for j := i + 1; j < len(query); j++ {
+		c := query[j]
+		if c == '$' {
+			return query[i : j+1], true
+		}
+		if !isIdentChar(c) || (j == i+1 && c >= '0' && c <= '9') {
+			return "", false
+		}
+	}
+	return "", false
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
@@ -0,0 +1,75 @@
+package migration
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration_log"
+)
+
+// Timeouts limit a migration, zero means no limit.
+type Timeouts struct {
+	// Statement is postgres statement_timeout of every statement of the migration
+	Statement time.Duration
+	// Lock is postgres lock_timeout of the migration
+	Lock time.Duration
+	// Migration is a deadline of the whole migration including its bookkeeping
+	Migration time.Duration
+}
+
+// override returns t with not zero timeouts of o.
+func (t Timeouts) override(o Timeouts) Timeouts {
+	if o.Statement > 0 {
+		t.Statement = o.Statement
+	}
+	if o.Lock > 0 {
+		t.Lock = o.Lock
+	}
+	if o.Migration > 0 {
+		t.Migration = o.Migration
+	}
+	return t
+}
+
+// SetTimeouts sets default timeouts of migrations, headers of a migration override them.
+func (s *Set) SetTimeouts(t Timeouts) {
+	s.timeouts = t
+}
+
+// applyAttempt executes migration with its timeouts and writes a failed row
+// to migration_service_logs if it fails.
+func (s *Set) applyAttempt(ctx context.Context, name string, priority, ver, curVersion int, mig Migration) error {
+	timeouts := s.timeouts.override(mig.Timeouts)
+	ctx = adapters.WithTimeouts(ctx, adapters.Timeouts{Statement: timeouts.Statement, Lock: timeouts.Lock})
+	if timeouts.Migration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeouts.Migration)
+		defer cancel()
+	}
+
+	err := s.execMigration(ctx, name, priority, ver, curVersion, mig)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && !errors.Is(err, adapters.ErrTimeout) {
+		err = &adapters.TimeoutError{Setting: "timeout", Timeout: timeouts.Migration, Err: err}
+	}
+
+	status := migration_log.StatusFailed
+	if errors.Is(err, adapters.ErrTimeout) {
+		status = migration_log.StatusTimeout
+	}
+	sLog := s.newLog(ctx, name, priority, ver, mig, status, err)
+	// ctx may be already canceled, the failure should be logged anyway
+	if lErr := s.repo.WriteMigrationServiceLog(context.Background(), sLog); lErr != nil {
+		s.log.Warn().Err(lErr).Msgf("cannot log failed migration for %s, version: %d, file: %s", name, ver, mig.Path)
+	}
+	return err
+}
+
+// isTimeout reports whether err of a query is caused by a timeout, allow_error does not tolerate such errors.
+func isTimeout(ctx context.Context, err error) bool {
+	return errors.Is(err, adapters.ErrTimeout) || ctx.Err() != nil
+}
@@ -0,0 +1,267 @@
+package migration
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Problem is a problem of migrations tree found by ValidateDir or ValidateFS.
+type Problem struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+	// Warning problems are reported but do not make the tree invalid
+	Warning bool `json:"warning,omitempty"`
+}
+
+func (p Problem) String() string {
+	level := "error"
+	if p.Warning {
+		level = "warning"
+	}
+	return fmt.Sprintf("%s: %s: %s", level, p.Path, p.Message)
+}
+
+// HasErrors returns true if there is at least one problem which is not a warning.
+func HasErrors(problems []Problem) bool {
+	for _, p := range problems {
+		if !p.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	serviceFolderRe = regexp.MustCompile(`^[0-9]+_.+$`)
+	// folderRe matches folders with not numeric service index, they are read with priority 0
+	folderRe   = regexp.MustCompile(`^[^_]+_.+$`)
+	fileNameRe = regexp.MustCompile(`^([0-9]+|R)_.+\.sql$`)
+)
+
+type fileVersion struct {
+	version int
+	path    string
+}
+
+// validator collects problems of the tree while walking it.
+type validator struct {
+	fsys     fs.FS
+	rootDir  string
+	problems []Problem
+	// versions are versions of every service, to find duplicates and gaps
+	versions map[string][]fileVersion
+	// dependencies are depends_on of every file, checked once all services are known
+	dependencies map[string][]Dependency
+}
+
+// ValidateDir checks migrations tree in the dir on disk without touching DB.
+func ValidateDir(dir string) []Problem {
+	return validateFS(os.DirFS(dir), ".", dir)
+}
+
+// ValidateFS checks migrations tree in the dir of fsys without touching DB.
+func ValidateFS(fsys fs.FS, dir string) []Problem {
+	return validateFS(fsys, dir, "")
+}
+
+func validateFS(fsys fs.FS, dir, rootDir string) []Problem {
+	if dir == "" {
+		dir = "."
+	}
+	v := &validator{
+		fsys:         fsys,
+		rootDir:      rootDir,
+		problems:     make([]Problem, 0),
+		versions:     make(map[string][]fileVersion),
+		dependencies: make(map[string][]Dependency),
+	}
+
+	err := fs.WalkDir(fsys, dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			v.add(name, err.Error(), false)
+			return nil
+		}
+		if name == dir {
+			return nil
+		}
+
+		// path of the file relative to dir, split by folders
+		rel := strings.Split(name, "/")
+		if dir != "." {
+			rel = strings.Split(name[len(dir)+1:], "/")
+		}
+		if d.IsDir() {
+			return v.checkDir(name, rel)
+		}
+		v.checkFile(name, rel)
+		return nil
+	})
+	if err != nil {
+		v.add(dir, err.Error(), false)
+	}
+
+	v.checkVersions()
+	v.checkDependencies()
+	return v.problems
+}
+
+func (v *validator) add(name, message string, warning bool) {
+	v.problems = append(v.problems, Problem{Path: v.fullPath(name), Message: message, Warning: warning})
+}
+
+// fullPath returns path of fsys file the same way as ReadDir sets it for migrations.
+func (v *validator) fullPath(name string) string {
+	return displayPath(name, v.rootDir)
+}
+
+// checkDir checks <service_index>_<service_name> folders and their subfolders.
+func (v *validator) checkDir(name string, rel []string) error {
+	switch len(rel) {
+	case 1:
+		if !folderRe.MatchString(rel[0]) {
+			v.add(name, "folder should have <service_index>_<service_name> format", false)
+		} else if !serviceFolderRe.MatchString(rel[0]) {
+			v.add(name, "service index should be a number, folder is read with service index 0", true)
+		}
+	case 2:
+		if strings.Contains(rel[1], "_") {
+			v.add(name, "subfolder should not have underscores, it would be read as <service_index>_<service_name> folder", false)
+		}
+	default:
+		v.add(name, "folder is too deep, only <service_index>_<service_name>/<subfolder> are supported", false)
+		return fs.SkipDir
+	}
+	return nil
+}
+
+func (v *validator) checkFile(name string, rel []string) {
+	base := path.Base(name)
+	if path.Ext(base) != ".sql" {
+		return
+	}
+
+	if len(rel) == 1 {
+		v.add(name, "file should be in <service_index>_<service_name> folder", false)
+		return
+	}
+
+	if isDownFile(base) {
+		upName := strings.TrimSuffix(name, downExt) + ".sql"
+		if _, err := fs.Stat(v.fsys, upName); err != nil {
+			v.add(name, "down file does not have up file "+path.Base(upName), false)
+		} else if strings.HasPrefix(path.Base(upName), repeatablePrefix) {
+			v.add(name, "repeatable migrations do not support down files", false)
+		}
+		return
+	}
+
+	if !fileNameRe.MatchString(base) {
+		v.add(name, "file should have <version>_<title>.sql or R_<title>.sql format", false)
+		return
+	}
+
+	data, err := fs.ReadFile(v.fsys, name)
+	if err != nil {
+		v.add(name, err.Error(), false)
+		return
+	}
+	if len(SplitStatements(string(data))) == 0 {
+		v.add(name, "file does not have SQL statements", false)
+	}
+
+	mig := NewMigration(string(data), name)
+	for _, key := range mig.UnknownKeys {
+		v.add(name, fmt.Sprintf("unknown header key '%s'", key), false)
+	}
+	for _, msg := range mig.HeaderErrors {
+		v.add(name, "invalid header: "+msg, false)
+	}
+	if mig.EnvRegex != "" {
+		if _, err := regexp.Compile(strings.TrimPrefix(mig.EnvRegex, "!")); err != nil {
+			v.add(name, fmt.Sprintf("invalid required_env regex '%s': %s", mig.EnvRegex, err), false)
+		}
+	}
+
+	stats, err := getMigrationInfo(name)
+	if err != nil {
+		var loadErr *LoadError
+		if errors.As(err, &loadErr) {
+			v.add(name, loadErr.Message, false)
+		} else {
+			v.add(name, err.Error(), false)
+		}
+		return
+	}
+	if len(mig.DependsOn) > 0 {
+		v.dependencies[name] = mig.DependsOn
+	}
+	if _, ok := v.versions[stats.ServiceName]; !ok {
+		v.versions[stats.ServiceName] = make([]fileVersion, 0)
+	}
+	if mig.Repeatable || strings.HasPrefix(base, repeatablePrefix) {
+		return
+	}
+	version, _ := strconv.Atoi(strings.SplitN(base, "_", 2)[0])
+	v.versions[stats.ServiceName] = append(v.versions[stats.ServiceName], fileVersion{version: version, path: name})
+}
+
+// checkVersions reports duplicated versions and gaps in numbering of every service.
+func (v *validator) checkVersions() {
+	services := make([]string, 0, len(v.versions))
+	for service := range v.versions {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	for _, service := range services {
+		files := v.versions[service]
+		sort.SliceStable(files, func(i, j int) bool { return files[i].version < files[j].version })
+
+		for i := 1; i < len(files); i++ {
+			prev, cur := files[i-1], files[i]
+			switch {
+			case cur.version == prev.version:
+				v.add(cur.path, fmt.Sprintf("version %d of service %s is already taken by %s", cur.version, service, v.fullPath(prev.path)), false)
+			case cur.version > prev.version+1:
+				v.add(cur.path, fmt.Sprintf("gap in numbering of service %s, previous version is %d", service, prev.version), true)
+			}
+		}
+	}
+}
+
+// checkDependencies reports depends_on targets which are not in the tree, cycles are reported by Plan.
+func (v *validator) checkDependencies() {
+	names := make([]string, 0, len(v.dependencies))
+	for name := range v.dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, dep := range v.dependencies[name] {
+			files, ok := v.versions[dep.Service]
+			if !ok {
+				v.add(name, fmt.Sprintf("depends on unknown service %s", dep.Service), false)
+				continue
+			}
+			if dep.Version == 0 {
+				continue
+			}
+			found := false
+			for _, f := range files {
+				found = found || f.version == dep.Version
+			}
+			if !found {
+				v.add(name, fmt.Sprintf("depends on %s which does not exist", dep), false)
+			}
+		}
+	}
+}
@@ -1,10 +1,53 @@
 package migration_log
 
+import "time"
+
+// Statuses of migration_service_logs rows.
+const (
+	StatusApplied = "applied"
+	// StatusTolerated is a migration applied with an error tolerated by allow_error
+	StatusTolerated = "tolerated"
+	StatusFailed    = "failed"
+	StatusTimeout   = "timeout"
+	// StatusSkipped is a migration skipped by required_env when service version moved past it
+	StatusSkipped = "skipped"
+	// StatusFaked is a migration marked as applied by --fake without executing it
+	StatusFaked      = "faked"
+	StatusRolledBack = "rolled_back"
+)
+
+// HasHash returns true for statuses of rows which hash is the hash of the schema in DB,
+// only such rows are compared with migration files.
+func HasHash(status string) bool {
+	switch status {
+	case "", StatusApplied, StatusTolerated, StatusFaked:
+		return true
+	}
+	return false
+}
+
+// MigrationServicesLog is a row of migration_service_logs, a row is written for every attempt.
 type MigrationServicesLog struct {
-	MigrationServiceName string
-	Priority             int
-	Version              int
-	FileName             string
-	SQL                  string
-	Hash                 string
+	MigrationServiceName string `json:"migration_services_name"`
+	Priority             int    `json:"priority"`
+	Version              int    `json:"version"`
+	FileName             string `json:"file_name"`
+	SQL                  string `json:"sql,omitempty"`
+	Hash                 string `json:"hash"`
+	// Status is StatusApplied for applied migrations, failed and tolerated ones are logged with error
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// SQLState is SQLSTATE of the error, if DB reports it
+	SQLState string `json:"sqlstate,omitempty"`
+	// Attempt is number of the attempt which is logged, transient failures are retried
+	Attempt    int       `json:"attempt,omitempty"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	// Duration is stored in duration_ms column
+	Duration time.Duration `json:"-"`
+	// EnvName, Host, BinaryVersion and GitCommit describe who executed the migration
+	EnvName       string `json:"env_name,omitempty"`
+	Host          string `json:"host,omitempty"`
+	BinaryVersion string `json:"binary_version,omitempty"`
+	GitCommit     string `json:"git_commit,omitempty"`
 }
@@ -3,41 +3,82 @@ package ports
 import (
 	"net/http"
 
-	"github.com/labstack/echo/v4"
+	"github.com/webdevelop-pro/go-common/configurator"
 	"github.com/webdevelop-pro/lib/logger"
 	"github.com/webdevelop-pro/lib/server"
+	"github.com/webdevelop-pro/migration-service/internal/services"
 )
 
+// Config of migration endpoints, it's read from the same MIGRATION_* variables as app config.
+type Config struct {
+	Dir string `required:"true"`
+	// ApiToken is a bearer token for http endpoints, endpoints are disabled if it's empty
+	ApiToken string `split_words:"true"`
+}
+
 type HttpServer struct {
-	log logger.Logger
+	log       logger.Logger
+	migration services.Migration
+	dir       string
+	token     string
 }
 
-func NewHttpServer() HttpServer {
+func NewHttpServer(migration services.Migration, cfg *Config) HttpServer {
 	return HttpServer{
-		log: logger.NewComponentLogger("api_handler", nil),
+		log:       logger.NewComponentLogger("api_handler", nil),
+		migration: migration,
+		dir:       cfg.Dir,
+		token:     cfg.ApiToken,
 	}
 }
 
-func InitHandlers(srv *server.HttpServer) {
+func InitHandlers(srv *server.HttpServer, migration services.Migration, c *configurator.Configurator) {
+	h := NewHttpServer(migration, c.New("migration_api", &Config{}, "migration").(*Config))
+
 	srv.AddRoute(server.Route{
-		Method: http.MethodPost,
+		Method: http.MethodGet,
 		Path:   "/liveness",
-		Handle: func(c echo.Context) error {
-			return c.JSON(http.StatusOK, nil)
-		},
+		Handle: h.Liveness,
 	})
 	srv.AddRoute(server.Route{
-		Method: http.MethodPost,
+		Method: http.MethodGet,
+		Path:   "/healthcheck",
+		Handle: h.Healthcheck,
+	})
+	// old misspelled path, kept for existing probes configuration
+	srv.AddRoute(server.Route{
+		Method: http.MethodGet,
 		Path:   "/healtchcheck",
-		Handle: func(c echo.Context) error {
-			return c.JSON(http.StatusOK, nil)
-		},
+		Handle: h.Healthcheck,
 	})
 	srv.AddRoute(server.Route{
-		Method: http.MethodPost,
+		Method: http.MethodGet,
 		Path:   "/readiness",
-		Handle: func(c echo.Context) error {
-			return c.JSON(http.StatusBadRequest, nil)
-		},
+		Handle: h.Readiness,
+	})
+	if h.token == "" {
+		h.log.Warn().Msg("MIGRATION_API_TOKEN is not set, migration endpoints are disabled")
+		return
+	}
+
+	srv.AddRoute(server.Route{
+		Method: http.MethodGet,
+		Path:   "/services",
+		Handle: h.Auth(h.ListServices),
+	})
+	srv.AddRoute(server.Route{
+		Method: http.MethodGet,
+		Path:   "/services/:name/sql",
+		Handle: h.Auth(h.GetSQL),
+	})
+	srv.AddRoute(server.Route{
+		Method: http.MethodPost,
+		Path:   "/services/:name/apply",
+		Handle: h.Auth(h.Apply),
+	})
+	srv.AddRoute(server.Route{
+		Method: http.MethodPost,
+		Path:   "/check",
+		Handle: h.Auth(h.Check),
 	})
 }
@@ -0,0 +1,133 @@
+package ports
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration"
+	"github.com/webdevelop-pro/migration-service/internal/services"
+)
+
+// ErrorResponse is returned by migration endpoints in case of an error.
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ServiceResponse describes service known by migration service.
+type ServiceResponse struct {
+	Name          string `json:"name"`
+	Priority      int    `json:"priority"`
+	Version       int    `json:"version"`
+	LatestVersion int    `json:"latest_version"`
+	Pending       int    `json:"pending"`
+}
+
+// SQLResponse is SQL which would be applied for service.
+type SQLResponse struct {
+	Service string `json:"service"`
+	SQL     string `json:"sql"`
+}
+
+// ApplyResponse is a result of applying migrations for service.
+type ApplyResponse struct {
+	Service string `json:"service"`
+	Applied int    `json:"applied"`
+}
+
+// CheckResponse is a result of comparing hashes of migration files with migration_service_logs.
+type CheckResponse struct {
+	AllEqual bool     `json:"all_equal"`
+	Files    []string `json:"files"`
+}
+
+// Auth allows request only with Authorization: Bearer <MIGRATION_API_TOKEN> header.
+func (h HttpServer) Auth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			return c.JSON(http.StatusUnauthorized, ErrorResponse{Code: "unauthorized", Message: "invalid bearer token"})
+		}
+		return next(c)
+	}
+}
+
+// errorResponse maps app errors to http status and error code.
+func (h HttpServer) errorResponse(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrServiceNotFound):
+		return c.JSON(http.StatusNotFound, ErrorResponse{Code: "service_not_found", Message: err.Error()})
+	case errors.Is(err, adapters.ErrLockTimeout):
+		return c.JSON(http.StatusConflict, ErrorResponse{Code: "locked", Message: err.Error()})
+	case errors.As(err, new(*migration.LoadError)):
+		h.log.Error().Err(err).Msgf("%s %s failed", c.Request().Method, c.Path())
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Code: "invalid_migrations", Message: err.Error()})
+	default:
+		h.log.Error().Err(err).Msgf("%s %s failed", c.Request().Method, c.Path())
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Code: "internal_error", Message: err.Error()})
+	}
+}
+
+// ListServices returns known services with current DB versions and number of pending migrations.
+// Service split by depends_on has several parts in the plan, it's listed once.
+func (h HttpServer) ListServices(c echo.Context) error {
+	plan, err := h.migration.Plan(h.dir)
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+
+	list := make([]ServiceResponse, 0, len(plan.Services))
+	index := make(map[string]int, len(plan.Services))
+	for _, sPlan := range plan.Services {
+		if i, ok := index[sPlan.Service]; ok {
+			list[i].LatestVersion = sPlan.ResultVersion
+			list[i].Pending += len(sPlan.Apply)
+			continue
+		}
+		index[sPlan.Service] = len(list)
+		list = append(list, ServiceResponse{
+			Name:          sPlan.Service,
+			Priority:      sPlan.Priority,
+			Version:       sPlan.CurrentVersion,
+			LatestVersion: sPlan.ResultVersion,
+			Pending:       len(sPlan.Apply),
+		})
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// GetSQL returns SQL of migrations which are not applied yet for the service.
+func (h HttpServer) GetSQL(c echo.Context) error {
+	name := c.Param("name")
+	sql, err := h.migration.GetSQL(c.Request().Context(), h.dir, name)
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, SQLResponse{Service: name, SQL: sql})
+}
+
+// Apply applies migrations which are not applied yet for the service.
+func (h HttpServer) Apply(c echo.Context) error {
+	name := c.Param("name")
+	n, err := h.migration.Apply(c.Request().Context(), name)
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, ApplyResponse{Service: name, Applied: n})
+}
+
+// Check compares hashes of all migration files with hashes in migration_service_logs.
+func (h HttpServer) Check(c echo.Context) error {
+	allEqual, list, err := h.migration.CheckMigrationHash([]string{h.dir})
+	if err != nil {
+		return h.errorResponse(c, err)
+	}
+	if list == nil {
+		list = make([]string, 0)
+	}
+	return c.JSON(http.StatusOK, CheckResponse{AllEqual: allEqual, Files: list})
+}
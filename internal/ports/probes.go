@@ -0,0 +1,47 @@
+package ports
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/webdevelop-pro/migration-service/internal/services"
+)
+
+// pingTimeout limits DB check of the health probe
+const pingTimeout = 5 * time.Second
+
+// HealthResponse is returned by health probe.
+type HealthResponse struct {
+	DB        string          `json:"db"`
+	LastApply services.Status `json:"last_apply"`
+}
+
+// Liveness reports that process is alive.
+func (h HttpServer) Liveness(c echo.Context) error {
+	return c.JSON(http.StatusOK, nil)
+}
+
+// Healthcheck checks DB connectivity and returns result of the last migrations run.
+func (h HttpServer) Healthcheck(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), pingTimeout)
+	defer cancel()
+
+	resp := HealthResponse{DB: "ok", LastApply: h.migration.Status()}
+	if err := h.migration.Ping(ctx); err != nil {
+		h.log.Error().Err(err).Msg("db is not available")
+		resp.DB = err.Error()
+		return c.JSON(http.StatusServiceUnavailable, resp)
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Readiness reports ready only after migrations were applied successfully.
+func (h HttpServer) Readiness(c echo.Context) error {
+	status := h.migration.Status()
+	if status.State != services.StateSucceeded {
+		return c.JSON(http.StatusServiceUnavailable, status)
+	}
+	return c.JSON(http.StatusOK, status)
+}
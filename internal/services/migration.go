@@ -1,7 +1,36 @@
 package services
 
-import "context"
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration"
+)
+
+const (
+	StatePending   = "pending"
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+)
+
+// ErrServiceNotFound is returned when there are no migrations for requested service.
+var ErrServiceNotFound = errors.New("service not found")
+
+// Status is a result of the last run of all migrations.
+type Status struct {
+	State     string    `json:"state"`
+	Applied   int       `json:"applied"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
 
 type Migration interface {
+	Plan(dir string) (migration.Plan, error)
+	GetSQL(ctx context.Context, dir string, serviceName string) (string, error)
 	Apply(ctx context.Context, serviceName string) (int, error)
+	CheckMigrationHash(args []string) (bool, []string, error)
+	Status() Status
+	Ping(ctx context.Context) error
 }
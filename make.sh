@@ -25,7 +25,7 @@ init() {
 }
 
 build() {
-  go build -ldflags "-s -w -X main.repository=${REPOSITORY} -X main.revisionID=${GIT_COMMIT} -X main.version=${BUILD_DATE}:${GIT_COMMIT} -X main.service=${SERVICE_NAME}" -o ./app ./cmd/server/*.go && chmod +x ./app
+  go build -ldflags "-s -w -X main.repository=${REPOSITORY} -X main.revisionID=${GIT_COMMIT} -X main.version=${BUILD_DATE}:${GIT_COMMIT} -X main.service=${SERVICE_NAME} -X github.com/webdevelop-pro/migration-service/internal/app.Version=${BUILD_DATE}:${GIT_COMMIT} -X github.com/webdevelop-pro/migration-service/internal/app.Commit=${GIT_COMMIT}" -o ./app ./cmd/server/*.go && chmod +x ./app
 }
 
 case $1 in
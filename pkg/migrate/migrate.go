@@ -0,0 +1,293 @@
+// Package migrate runs migrations in-process, without the migration service app,
+// e.g. on start of a Go service or in integration tests.
+//
+//	//go:embed migrations
+//	var migrations embed.FS
+//
+//	m, err := migrate.New(migrate.WithPool(pool), migrate.WithFS(migrations, "migrations"), migrate.WithEnv("dev"))
+//	if err != nil {
+//		return err
+//	}
+//	n, err := m.Apply(ctx)
+package migrate
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+	"github.com/webdevelop-pro/migration-service/internal/adapters/repository/postgres"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration"
+)
+
+// Repository is a DB which migrations are applied to, see WithRepository.
+type Repository interface {
+	// Ping checks DB connectivity
+	Ping(ctx context.Context) error
+}
+
+// ErrLockTimeout is returned by Apply and Fake if another instance holds migration lock for too long.
+var ErrLockTimeout = adapters.ErrLockTimeout
+
+// ErrTimeout is returned by Apply if a migration exceeds one of its timeouts, see WithTimeouts.
+var ErrTimeout = adapters.ErrTimeout
+
+// ErrTransient is returned by Apply if a migration failed by lock_timeout, serialization failure
+// or deadlock more times than WithRetry allows.
+var ErrTransient = adapters.ErrTransient
+
+// ErrSchemaVersion is returned if bookkeeping tables were upgraded by a newer version of migration service.
+var ErrSchemaVersion = adapters.ErrSchemaVersion
+
+// Timeouts are default timeouts of migrations, headers of a migration override them.
+type Timeouts struct {
+	// Statement is postgres statement_timeout of every statement of the migration
+	Statement time.Duration
+	// Lock is postgres lock_timeout of the migration
+	Lock time.Duration
+	// Migration is a deadline of the whole migration including its bookkeeping
+	Migration time.Duration
+}
+
+// Retry configures retries of migrations failed by transient errors.
+type Retry struct {
+	// Retries is number of attempts after the first one, zero disables retries
+	Retries int
+	// Backoff is a pause before the first retry, it's doubled for every next one
+	Backoff time.Duration
+	// MaxBackoff limits the pause, zero means no limit
+	MaxBackoff time.Duration
+}
+
+// Executor is written to every row of migration_service_logs, so it's known who applied a migration.
+type Executor struct {
+	EnvName string
+	// Host is a host or pod name
+	Host string
+	// Version and Commit are version and git commit of the application running migrations
+	Version string
+	Commit  string
+}
+
+const defaultLockTimeout = 5 * time.Minute
+
+type options struct {
+	repo        adapters.Repository
+	fsys        fs.FS
+	dir         string
+	envName     string
+	lockKey     int64
+	lockTimeout time.Duration
+	workers     int
+	timeouts    Timeouts
+	retry       Retry
+	executor    Executor
+	// custom is a repository set by WithRepository
+	custom Repository
+}
+
+// Option configures Migrator.
+type Option func(*options)
+
+// WithPool runs migrations against postgres through the pool.
+func WithPool(pool *pgxpool.Pool) Option {
+	return func(o *options) {
+		o.repo = postgres.NewWithPool(pool)
+	}
+}
+
+// WithRepository runs migrations against repo, e.g. another DB or a fake for tests.
+// Only repositories of the migration service are supported, New returns error for others.
+func WithRepository(repo Repository) Option {
+	return func(o *options) {
+		o.custom = repo
+	}
+}
+
+// WithFS reads migrations from dir of fsys, dir should contain <priority>_<service> folders.
+func WithFS(fsys fs.FS, dir string) Option {
+	return func(o *options) {
+		o.fsys = fsys
+		o.dir = dir
+	}
+}
+
+// WithEnv sets env name which is matched against required_env of migrations.
+func WithEnv(envName string) Option {
+	return func(o *options) {
+		o.envName = envName
+	}
+}
+
+// WithLock sets migration lock key and how long to wait for it, zero key is derived from DB name.
+func WithLock(key int64, timeout time.Duration) Option {
+	return func(o *options) {
+		o.lockKey = key
+		o.lockTimeout = timeout
+	}
+}
+
+// WithWorkers applies services of one priority folder concurrently by n workers,
+// pool should have at least n+1 connections, one is taken by the migration lock.
+func WithWorkers(n int) Option {
+	return func(o *options) {
+		o.workers = n
+	}
+}
+
+// WithTimeouts sets default statement_timeout, lock_timeout and deadline of migrations.
+func WithTimeouts(t Timeouts) Option {
+	return func(o *options) {
+		o.timeouts = t
+	}
+}
+
+// WithRetry retries migrations failed by lock_timeout, serialization failures and deadlocks.
+func WithRetry(r Retry) Option {
+	return func(o *options) {
+		o.retry = r
+	}
+}
+
+// WithExecutor sets executor logged with migrations, env name and hostname are used by default.
+func WithExecutor(e Executor) Option {
+	return func(o *options) {
+		o.executor = e
+	}
+}
+
+// Migrator applies migrations from a source FS.
+type Migrator struct {
+	opts options
+	// mu serializes operations on set
+	mu  sync.Mutex
+	set *migration.Set
+}
+
+// New returns new Migrator, repository and source FS are required.
+func New(opts ...Option) (*Migrator, error) {
+	o := options{dir: ".", lockTimeout: defaultLockTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.custom != nil {
+		repo, ok := o.custom.(adapters.Repository)
+		if !ok {
+			return nil, errors.Errorf("unsupported repository %T", o.custom)
+		}
+		o.repo = repo
+	}
+	if o.repo == nil {
+		return nil, errors.New("repository is required, use WithPool or WithRepository")
+	}
+	if o.fsys == nil {
+		return nil, errors.New("source is required, use WithFS")
+	}
+
+	set := migration.New(o.repo)
+	set.SetWorkers(o.workers)
+	set.SetTimeouts(migration.Timeouts(o.timeouts))
+	set.SetRetry(migration.Retry(o.retry))
+	if o.executor.EnvName == "" {
+		o.executor.EnvName = o.envName
+	}
+	if o.executor.Host == "" {
+		o.executor.Host, _ = os.Hostname()
+	}
+	set.SetExecutor(migration.Executor(o.executor))
+
+	return &Migrator{
+		opts: o,
+		set:  set,
+	}, nil
+}
+
+// read reloads migrations from the source, so files are always up to date.
+func (m *Migrator) read() error {
+	m.set.ClearData()
+	if err := migration.ReadFS(m.opts.fsys, m.opts.dir, m.set); err != nil {
+		return errors.Wrapf(err, "cannot read migrations from %s", m.opts.dir)
+	}
+	return nil
+}
+
+// lock takes migration lock and upgrades bookkeeping tables before any migration is applied.
+func (m *Migrator) lock(ctx context.Context) (func(), error) {
+	unlock, err := m.opts.repo.Lock(ctx, m.opts.lockKey, m.opts.lockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.opts.repo.CreateMigrationTable(ctx); err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+// Plan returns what Apply would do without executing anything.
+func (m *Migrator) Plan(ctx context.Context) (Plan, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.read(); err != nil {
+		return Plan{}, err
+	}
+	plan, err := m.set.Plan(ctx, false, m.opts.envName)
+	if err != nil {
+		return Plan{}, err
+	}
+	return newPlan(plan), nil
+}
+
+// Apply applies not applied migrations of all services and returns number of applied files.
+func (m *Migrator) Apply(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.read(); err != nil {
+		return 0, err
+	}
+
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	return m.set.ApplyAll(ctx, false, m.opts.envName)
+}
+
+// Check compares hashes of migration files with migration logs and returns paths of changed files.
+func (m *Migrator) Check(ctx context.Context) (allEqual bool, changed []string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.read(); err != nil {
+		return false, nil, err
+	}
+	return m.set.CheckMigrationHash(ctx)
+}
+
+// Fake marks all migrations as applied without executing them and returns number of services.
+func (m *Migrator) Fake(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.read(); err != nil {
+		return 0, err
+	}
+
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	return m.set.FakeAll(ctx)
+}
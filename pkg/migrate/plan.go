@@ -0,0 +1,61 @@
+package migrate
+
+import "github.com/webdevelop-pro/migration-service/internal/domain/migration"
+
+// PlanFile is a migration file which would be executed or skipped by Apply.
+type PlanFile struct {
+	Version       int      `json:"version"`
+	Path          string   `json:"path"`
+	RequiredEnv   string   `json:"required_env,omitempty"`
+	NoTransaction bool     `json:"no_transaction,omitempty"`
+	Repeatable    bool     `json:"repeatable,omitempty"`
+	Description   string   `json:"description,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+// ServicePlan describes what Apply would do for a single service.
+type ServicePlan struct {
+	Priority       int        `json:"priority"`
+	Service        string     `json:"service"`
+	CurrentVersion int        `json:"current_version"`
+	Apply          []PlanFile `json:"apply"`
+	Skipped        []PlanFile `json:"skipped"`
+	ResultVersion  int        `json:"result_version"`
+}
+
+// Plan describes what Apply would do, in the same order as Apply does it.
+// A service is split in several parts if it waits for migrations of other services in the middle.
+type Plan struct {
+	EnvName string `json:"env_name"`
+	// TransactionalDDL is false if DB commits DDL implicitly, so no migration is atomic
+	TransactionalDDL bool          `json:"transactional_ddl"`
+	Services         []ServicePlan `json:"services"`
+}
+
+// newPlan copies plan of the engine, so its changes do not break users of the package.
+func newPlan(plan migration.Plan) Plan {
+	p := Plan{
+		EnvName:          plan.EnvName,
+		TransactionalDDL: plan.TransactionalDDL,
+		Services:         make([]ServicePlan, 0, len(plan.Services)),
+	}
+	for _, sPlan := range plan.Services {
+		p.Services = append(p.Services, ServicePlan{
+			Priority:       sPlan.Priority,
+			Service:        sPlan.Service,
+			CurrentVersion: sPlan.CurrentVersion,
+			Apply:          newPlanFiles(sPlan.Apply),
+			Skipped:        newPlanFiles(sPlan.Skipped),
+			ResultVersion:  sPlan.ResultVersion,
+		})
+	}
+	return p
+}
+
+func newPlanFiles(files []migration.PlanFile) []PlanFile {
+	list := make([]PlanFile, 0, len(files))
+	for _, file := range files {
+		list = append(list, PlanFile(file))
+	}
+	return list
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/webdevelop-pro/migration-service/internal/adapters/repository/memory"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration"
+)
+
+//go:embed migrations/TestMigrationPriorities
+var embedMigrations embed.FS
+
+// TestUnitReadEmbedFS checks migrations embedded into binary are applied the same way as from disk
+func TestUnitReadEmbedFS(t *testing.T) {
+	repo := memory.NewRepository()
+	set := migration.New(repo)
+	if err := migration.ReadFS(embedMigrations, "migrations/TestMigrationPriorities", set); err != nil {
+		t.Fatalf("cannot read migrations: %s", err)
+	}
+
+	if _, err := set.ApplyAll(context.Background(), false, "dev"); err != nil {
+		t.Fatalf("cannot apply migrations: %s", err)
+	}
+
+	exp := []string{"01_init.sql", "02_add_email.sql", "04_add_bitint.sql", "01_create.sql", "02_add_id.sql"}
+	if files := executedFiles(repo); !reflect.DeepEqual(files, exp) {
+		t.Errorf("expected files %v, got %v", exp, files)
+	}
+	checkVersion(t, repo, "user_user", 4)
+	checkVersion(t, repo, "email_emails", 2)
+}
+
+// TestUnitReadMapFS checks naming rules for subfolders and down files over fs.FS
+func TestUnitReadMapFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"db/01_user_users/01_init.sql":         {Data: []byte("CREATE TABLE user_users (id int);")},
+		"db/01_user_users/01_init.down.sql":    {Data: []byte("DROP TABLE user_users;")},
+		"db/01_user_users/readme.md":           {Data: []byte("not a migration")},
+		"db/01_user_users/seeds/01_seed.sql":   {Data: []byte("INSERT INTO user_users VALUES (1);")},
+		"db/02_email_emails/01_create.sql":     {Data: []byte("CREATE TABLE email_emails (id int);")},
+		"db/02_email_emails/03_add_column.sql": {Data: []byte("ALTER TABLE email_emails ADD COLUMN a int;")},
+	}
+
+	repo := memory.NewRepository()
+	set := migration.New(repo)
+	if err := migration.ReadFS(fsys, "db", set); err != nil {
+		t.Fatalf("cannot read migrations: %s", err)
+	}
+
+	plan, err := set.Plan(context.Background(), false, "dev")
+	if err != nil {
+		t.Fatalf("cannot plan migrations: %s", err)
+	}
+
+	versions := make(map[string]int)
+	for _, sPlan := range plan.Services {
+		versions[sPlan.Service] = sPlan.ResultVersion
+	}
+	exp := map[string]int{"user_users": 1, "user_users_seeds": 1, "email_emails": 3}
+	if !reflect.DeepEqual(versions, exp) {
+		t.Errorf("expected service versions %v, got %v", exp, versions)
+	}
+
+	if _, err := set.ApplyAll(context.Background(), false, "dev"); err != nil {
+		t.Fatalf("cannot apply migrations: %s", err)
+	}
+	if n, err := set.Rollback(context.Background(), "user_users", 0, 1, "dev"); err != nil || n != 1 {
+		t.Errorf("expected down file to be read together with up file, got %d, %v", n, err)
+	}
+}
+
+// TestUnitReadErrors checks loading failures are returned as typed errors with the path
+func TestUnitReadErrors(t *testing.T) {
+	cases := []struct {
+		fsys fstest.MapFS
+		kind error
+		path string
+	}{
+		{fstest.MapFS{"db/01_user/first.sql": {Data: []byte("SELECT 1;")}}, migration.ErrBadFileName, "db/01_user/first.sql"},
+		{fstest.MapFS{"db/user/01_init.sql": {Data: []byte("SELECT 1;")}}, migration.ErrBadServiceFolder, "db/user/01_init.sql"},
+		{fstest.MapFS{}, migration.ErrUnreadable, "db"},
+		{fstest.MapFS{
+			"db/01_user/01_init.sql":  {Data: []byte("SELECT 1;")},
+			"db/01_user/01_again.sql": {Data: []byte("SELECT 1;")},
+		}, migration.ErrDuplicateVersion, "db/01_user/01_init.sql"},
+		{fstest.MapFS{
+			"db/01_user/00_init.sql":  {Data: []byte("SELECT 1;")},
+			"db/01_user/00_again.sql": {Data: []byte("SELECT 1;")},
+		}, migration.ErrDuplicateVersion, "db/01_user/00_init.sql"},
+		{fstest.MapFS{"db/01_user/-1_init.sql": {Data: []byte("SELECT 1;")}}, migration.ErrBadFileName, "db/01_user/-1_init.sql"},
+		{fstest.MapFS{
+			"db/01_user/01_init.sql":             {Data: []byte("SELECT 1;")},
+			"db/01_user/01_init.down.sql/README": {Data: []byte("not a file")},
+		}, migration.ErrUnreadable, "db/01_user/01_init.down.sql"},
+	}
+
+	for _, c := range cases {
+		err := migration.ReadFS(c.fsys, "db", migration.New(memory.NewRepository()))
+		if !errors.Is(err, c.kind) {
+			t.Errorf("expected %v, got %v", c.kind, err)
+			continue
+		}
+		var loadErr *migration.LoadError
+		if !errors.As(err, &loadErr) || loadErr.Path != c.path {
+			t.Errorf("expected error of %s, got %v", c.path, err)
+		}
+	}
+}
+
+// TestUnitReadNotNumericServiceIndex checks folder with not numeric service index is read with priority 0
+func TestUnitReadNotNumericServiceIndex(t *testing.T) {
+	fsys := fstest.MapFS{
+		"db/x_user/01_init.sql":   {Data: []byte("SELECT 1;")},
+		"db/01_email/01_init.sql": {Data: []byte("SELECT 1;")},
+	}
+	set := migration.New(memory.NewRepository())
+	if err := migration.ReadFS(fsys, "db", set); err != nil {
+		t.Fatalf("cannot read migrations: %s", err)
+	}
+
+	plan, err := set.Plan(context.Background(), false, "dev")
+	if err != nil {
+		t.Fatalf("cannot plan migrations: %s", err)
+	}
+	if len(plan.Services) != 2 || plan.Services[0].Service != "user" || plan.Services[0].Priority != 0 {
+		t.Errorf("expected user service with priority 0 first, got %+v", plan.Services)
+	}
+}
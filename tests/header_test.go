@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration"
+)
+
+// TestUnitHeader checks directives are parsed from leading comment lines of migration
+func TestUnitHeader(t *testing.T) {
+	mig := migration.NewMigration(`-- creates users table, see https://example.com/docs
+--- required_env: ^(dev|stage)-[a-z]{1,3}$, allow_error: true
+-- description: "users, with emails", tags: users auth
+-- no_transaction: yes
+-- owner: team
+CREATE TABLE users(id int);
+-- allow_error: false
+`, "01_user/01_init.sql")
+
+	if mig.EnvRegex != "^(dev|stage)-[a-z]{1,3}$" {
+		t.Errorf("unexpected required_env %q", mig.EnvRegex)
+	}
+	if !mig.AllowError || !mig.NoTransaction {
+		t.Errorf("expected allow_error and no_transaction, got %+v", mig)
+	}
+	if mig.Description != "users, with emails" {
+		t.Errorf("unexpected description %q", mig.Description)
+	}
+	if !reflect.DeepEqual(mig.Tags, []string{"users", "auth"}) {
+		t.Errorf("unexpected tags %v", mig.Tags)
+	}
+	if !reflect.DeepEqual(mig.UnknownKeys, []string{"owner"}) || len(mig.HeaderErrors) != 0 {
+		t.Errorf("expected only unknown key owner, got %v, %v", mig.UnknownKeys, mig.HeaderErrors)
+	}
+
+	mig = migration.NewMigration("-- allow_error: 42p07, duplicate_column\nALTER TABLE users ADD id int;", "01_user/02_add.sql")
+	if !mig.AllowError || !reflect.DeepEqual(mig.AllowErrors, []string{"42P07", "42701"}) {
+		t.Errorf("expected allowed SQLSTATEs 42P07 and 42701, got %v", mig.AllowErrors)
+	}
+
+	mig = migration.NewMigration("-- allow_error: maybe\n-- required_env: 'dev\nSELECT 1;", "01_user/02_bad.sql")
+	if mig.AllowError || len(mig.HeaderErrors) != 2 {
+		t.Errorf("expected 2 header errors, got %v", mig.HeaderErrors)
+	}
+}
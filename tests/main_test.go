@@ -3,17 +3,20 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"testing"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/rs/zerolog/log"
 	"github.com/webdevelop-pro/go-common/configurator"
 	"github.com/webdevelop-pro/go-common/logger"
 	"github.com/webdevelop-pro/lib/db"
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
 	"github.com/webdevelop-pro/migration-service/internal/adapters/repository/postgres"
 	"github.com/webdevelop-pro/migration-service/internal/app"
 	"github.com/webdevelop-pro/migration-service/internal/domain/migration"
@@ -43,6 +46,10 @@ func testInit() (logger.Logger, *configurator.Configurator, *postgres.Repository
 	if err != nil {
 		_log.Fatal().Err(err).Msg("can't drop table migration_services from DB")
 	}
+	_, err = rawPG.Exec(context.Background(), "DROP TABLE IF EXISTS migration_service_meta")
+	if err != nil {
+		_log.Fatal().Err(err).Msg("can't drop table migration_service_meta from DB")
+	}
 
 	return _log, c, pg, _migration, rawPG, ctx
 }
@@ -289,6 +296,115 @@ func TestMigrationLog(t *testing.T) {
 	checkValueResults(t, rawPG, _log, "03_add_bitint.sql", "migration_service_logs", "file_name", 3)
 }
 
+// TestNoTransaction checks no_transaction migrations are executed outside of a transaction
+func TestNoTransaction(t *testing.T) {
+	_log, _, _, _migration, rawPG, _ := testInit()
+
+	if err := _migration.ApplyAll("./migrations/TestNoTransaction"); err != nil {
+		_log.Fatal().Err(err).Msg("cannot apply migrations")
+	}
+	checkResultsByService(t, rawPG, _log, "user_users", 2)
+	checkRecordsCount(t, rawPG, _log, "pg_indexes WHERE tablename = 'user_users' AND indexname LIKE 'user_users_%_idx'", 2)
+}
+
+// TestRollback checks down migrations are applied in reverse order till target version
+func TestRollback(t *testing.T) {
+	_log, _, _, _migration, rawPG, ctx := testInit()
+
+	if err := _migration.ApplyAll("./migrations/TestRollback"); err != nil {
+		_log.Fatal().Err(err).Msg("cannot apply migrations")
+	}
+	checkResultsByService(t, rawPG, _log, "user_users", 3)
+
+	n, err := _migration.Rollback(ctx, "./migrations/TestRollback", "user_users", 1)
+	if err != nil {
+		_log.Fatal().Err(err).Msg("cannot rollback migrations")
+	}
+	if n != 2 {
+		t.Errorf("expected 2 rolled back versions, got %d", n)
+	}
+	checkResultsByService(t, rawPG, _log, "user_users", 1)
+	checkRecordsCount(t, rawPG, _log, "migration_service_logs WHERE rolled_back_at IS NOT NULL", 2)
+	checkRecordsCount(t, rawPG, _log, "information_schema.columns WHERE table_name = 'user_users' AND column_name = 'email'", 0)
+}
+
+// TestApplyService checks service applied through the API is logged with its priority and can be rolled back
+func TestApplyService(t *testing.T) {
+	os.Setenv("MIGRATION_DIR", "./migrations/TestRollback")
+	_log, _, _, _migration, rawPG, ctx := testInit()
+
+	n, err := _migration.Apply(ctx, "user_users")
+	if err != nil {
+		_log.Fatal().Err(err).Msg("cannot apply migrations")
+	}
+	if n != 3 {
+		t.Errorf("expected 3 applied versions, got %d", n)
+	}
+	checkResultsByService(t, rawPG, _log, "user_users", 3)
+	checkRecordsCount(t, rawPG, _log, "migration_service_logs WHERE priority = 1 AND status = 'applied'", 3)
+
+	n, err = _migration.Rollback(ctx, "./migrations/TestRollback", "user_users", 1)
+	if err != nil {
+		_log.Fatal().Err(err).Msg("cannot rollback migrations")
+	}
+	if n != 2 {
+		t.Errorf("expected 2 rolled back versions, got %d", n)
+	}
+	checkResultsByService(t, rawPG, _log, "user_users", 1)
+	checkRecordsCount(t, rawPG, _log, "migration_service_logs WHERE rolled_back_at IS NOT NULL", 2)
+}
+
+// TestPlan checks plan shows files to apply and skip without applying them
+func TestPlan(t *testing.T) {
+	os.Setenv("ENV_NAME", "master")
+	_log, _, _, _migration, rawPG, _ := testInit()
+
+	plan, err := _migration.Plan("./migrations/TestPlan")
+	if err != nil {
+		_log.Fatal().Err(err).Msg("cannot plan migrations")
+	}
+	if len(plan.Services) != 2 {
+		t.Fatalf("expected 2 services in plan, got %d", len(plan.Services))
+	}
+
+	users := plan.Services[0]
+	if users.Service != "user_users" || users.CurrentVersion != 0 || users.ResultVersion != 2 || len(users.Apply) != 2 {
+		t.Errorf("unexpected plan for user_users: %+v", users)
+	}
+
+	seeds := plan.Services[1]
+	if seeds.Service != "user_users_seeds" || seeds.ResultVersion != 0 || len(seeds.Apply) != 0 || len(seeds.Skipped) != 1 {
+		t.Errorf("unexpected plan for user_users_seeds: %+v", seeds)
+	}
+
+	checkRecordsCount(t, rawPG, _log, "migration_services", 0)
+	checkRecordsCount(t, rawPG, _log, "migration_service_logs", 0)
+}
+
+// TestLock checks only one instance can hold migration lock at a time
+func TestLock(t *testing.T) {
+	_log, _, pg, _, _, ctx := testInit()
+
+	unlock, err := pg.Lock(ctx, 0, time.Second)
+	if err != nil {
+		_log.Fatal().Err(err).Msg("cannot take migration lock")
+	}
+
+	// second instance has its own connection and should wait for the first one
+	second := postgres.New(configurator.NewConfigurator())
+	if _, err := second.Lock(ctx, 0, time.Second); !errors.Is(err, adapters.ErrLockTimeout) {
+		t.Errorf("expected lock timeout, got %v", err)
+	}
+
+	unlock()
+	unlockSecond, err := second.Lock(ctx, 0, time.Second)
+	if err != nil {
+		t.Errorf("lock should be released, got %v", err)
+	} else {
+		unlockSecond()
+	}
+}
+
 // TestMigrationLog checks writing logs to migration_service_logs table
 func TestRequiredEnvInvertion(t *testing.T) {
 	// we will create new migrations for user_user service and verify
@@ -0,0 +1,572 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+	"github.com/webdevelop-pro/migration-service/internal/adapters/repository/memory"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration_log"
+)
+
+func memoryInit(t *testing.T, dir string) (*memory.Repository, *migration.Set) {
+	repo := memory.NewRepository()
+	set := migration.New(repo)
+	if err := migration.ReadDir(dir, "", set); err != nil {
+		t.Fatalf("cannot read migrations: %s", err)
+	}
+	return repo, set
+}
+
+// executedFiles returns base names of files in execution order, every file only once
+func executedFiles(repo *memory.Repository) []string {
+	files := make([]string, 0)
+	for _, statement := range repo.Executed() {
+		file := filepath.Base(statement.File)
+		if len(files) == 0 || files[len(files)-1] != file {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+func checkVersion(t *testing.T, repo *memory.Repository, service string, expVer int) {
+	t.Helper()
+	ver, _ := repo.GetServiceVersion(context.Background(), service)
+	if ver != expVer {
+		t.Errorf("expected %s version %d, got %d", service, expVer, ver)
+	}
+}
+
+// TestUnitMemoryOrder checks services are applied by priority and files by version
+func TestUnitMemoryOrder(t *testing.T) {
+	repo, set := memoryInit(t, "./migrations/TestMigrationPriorities")
+
+	n, err := set.ApplyAll(context.Background(), false, "dev")
+	if err != nil {
+		t.Fatalf("cannot apply migrations: %s", err)
+	}
+	if n != 5 {
+		t.Errorf("expected 5 applied migrations, got %d", n)
+	}
+
+	exp := []string{"01_init.sql", "02_add_email.sql", "04_add_bitint.sql", "01_create.sql", "02_add_id.sql"}
+	if files := executedFiles(repo); !reflect.DeepEqual(files, exp) {
+		t.Errorf("expected files %v, got %v", exp, files)
+	}
+	checkVersion(t, repo, "user_user", 4)
+	checkVersion(t, repo, "email_emails", 2)
+
+	// nothing left to apply on the second run
+	n, err = set.ApplyAll(context.Background(), false, "dev")
+	if err != nil || n != 0 {
+		t.Errorf("expected nothing to apply, got %d, %v", n, err)
+	}
+}
+
+// TestUnitMemoryRequiredEnv checks migrations with not matching required_env are skipped
+func TestUnitMemoryRequiredEnv(t *testing.T) {
+	repo, set := memoryInit(t, "./migrations/RequiredEnv/BranchInvertion")
+
+	if _, err := set.ApplyAll(context.Background(), false, "master"); err != nil {
+		t.Fatalf("cannot apply migrations: %s", err)
+	}
+	if len(repo.Executed()) != 0 {
+		t.Errorf("expected nothing executed for master, got %v", repo.Executed())
+	}
+	checkVersion(t, repo, "user", 0)
+
+	if _, err := set.ApplyAll(context.Background(), false, "dev"); err != nil {
+		t.Fatalf("cannot apply migrations: %s", err)
+	}
+	checkVersion(t, repo, "user", 1)
+}
+
+// TestUnitMemoryFileError checks failed file stops service and is not recorded
+func TestUnitMemoryFileError(t *testing.T) {
+	repo, set := memoryInit(t, "./migrations/TestMigrationPriorities")
+	repo.FailFile("migrations/TestMigrationPriorities/01_user_user/02_add_email.sql", errors.New("injected"))
+
+	if _, err := set.ApplyAll(context.Background(), false, "dev"); err == nil {
+		t.Fatal("expected error of the failed file")
+	}
+
+	exp := []string{"01_init.sql"}
+	if files := executedFiles(repo); !reflect.DeepEqual(files, exp) {
+		t.Errorf("expected files %v, got %v", exp, files)
+	}
+	checkVersion(t, repo, "user_user", 1)
+	checkVersion(t, repo, "email_emails", 0)
+}
+
+// TestUnitMemoryStatementError checks statements of failed file are rolled back together
+func TestUnitMemoryStatementError(t *testing.T) {
+	repo, set := memoryInit(t, "./migrations/TestServicePriorities")
+	repo.FailStatement("CREATE INDEX", errors.New("injected"))
+
+	_, err := set.ApplyAll(context.Background(), false, "dev")
+	var sErr *adapters.StatementError
+	if !errors.As(err, &sErr) {
+		t.Fatalf("expected error of the failed statement, got %v", err)
+	}
+	if filepath.Base(sErr.File) != "01_init.sql" || sErr.Index != 2 || sErr.Line != 7 || sErr.Column != 1 {
+		t.Errorf("expected second statement at line 7 of 01_init.sql, got %s:%d:%d statement %d", sErr.File, sErr.Line, sErr.Column, sErr.Index)
+	}
+
+	for _, statement := range repo.Executed() {
+		if filepath.Base(filepath.Dir(statement.File)) == "02_email" {
+			t.Errorf("statement of failed file should not be recorded: %s", statement.SQL)
+		}
+	}
+	checkVersion(t, repo, "user", 1)
+	checkVersion(t, repo, "email", 0)
+}
+
+// TestUnitStatementPositions checks statements are split by top level semicolons with their positions
+func TestUnitStatementPositions(t *testing.T) {
+	query := "-- comment;\nCREATE FUNCTION f() RETURNS text AS $body$\n  SELECT 'a;b';\n$body$ LANGUAGE sql;\n\n  /* ; */ SELECT \"é;\"; SELECT 1"
+	statements := migration.ParseStatements(query)
+	exp := []migration.Statement{
+		{SQL: "-- comment;\nCREATE FUNCTION f() RETURNS text AS $body$\n  SELECT 'a;b';\n$body$ LANGUAGE sql;", Offset: 0, Line: 1, Column: 1},
+		{SQL: "/* ; */ SELECT \"é;\";", Offset: 95, Line: 6, Column: 3},
+		{SQL: "SELECT 1", Offset: 117, Line: 6, Column: 24},
+	}
+	if !reflect.DeepEqual(statements, exp) {
+		t.Errorf("expected statements %#v, got %#v", exp, statements)
+	}
+}
+
+// TestUnitStatementAtomic checks BEGIN ATOMIC bodies with CASE expressions are not split
+func TestUnitStatementAtomic(t *testing.T) {
+	query := "CREATE FUNCTION f() RETURNS int LANGUAGE sql BEGIN ATOMIC SELECT 1; SELECT 2; END;\n" +
+		"create procedure p(a int) language sql begin atomic\n  select case when a > 0 then 1 else 0 end;\n  select 3;\nend;\n" +
+		"SELECT begin_date, atomic FROM t; END;"
+	exp := []string{
+		"CREATE FUNCTION f() RETURNS int LANGUAGE sql BEGIN ATOMIC SELECT 1; SELECT 2; END;",
+		"create procedure p(a int) language sql begin atomic\n  select case when a > 0 then 1 else 0 end;\n  select 3;\nend;",
+		"SELECT begin_date, atomic FROM t;",
+		"END;",
+	}
+	if statements := migration.SplitStatements(query); !reflect.DeepEqual(statements, exp) {
+		t.Errorf("expected statements %q, got %q", exp, statements)
+	}
+}
+
+// TestUnitMemoryFake checks fake apply bumps versions without executing anything
+func TestUnitMemoryFake(t *testing.T) {
+	repo, set := memoryInit(t, "./migrations/TestMigrationPriorities")
+
+	if _, err := set.FakeAll(context.Background()); err != nil {
+		t.Fatalf("cannot fake migrations: %s", err)
+	}
+	if len(repo.Executed()) != 0 {
+		t.Errorf("expected nothing executed, got %v", repo.Executed())
+	}
+	checkVersion(t, repo, "user_user", 4)
+	checkVersion(t, repo, "email_emails", 2)
+
+	for _, log := range repo.Snapshot().Logs {
+		if log.Status != migration_log.StatusFaked {
+			t.Errorf("expected faked status of %s, got %s", log.FileName, log.Status)
+		}
+	}
+	if n := len(repo.Snapshot().Logs); n != 5 {
+		t.Errorf("expected 5 faked migrations, got %d", n)
+	}
+}
+
+// TestUnitMemoryCheckHash checks changed files are reported by hash check
+func TestUnitMemoryCheckHash(t *testing.T) {
+	repo, set := memoryInit(t, "./migrations/TestMigrationPriorities")
+
+	if _, err := set.ApplyAll(context.Background(), false, "dev"); err != nil {
+		t.Fatalf("cannot apply migrations: %s", err)
+	}
+	allEqual, list, err := set.CheckMigrationHash(context.Background())
+	if err != nil || !allEqual || len(list) != 0 {
+		t.Errorf("expected all hashes equal, got %v, %v, %v", allEqual, list, err)
+	}
+
+	snapshot := repo.Snapshot()
+	for i := range snapshot.Logs {
+		if snapshot.Logs[i].FileName == "04_add_bitint.sql" {
+			snapshot.Logs[i].Hash = "changed"
+		}
+	}
+	repo.Load(snapshot)
+
+	allEqual, list, err = set.CheckMigrationHash(context.Background())
+	if err != nil || allEqual || len(list) != 1 || filepath.Base(list[0]) != "04_add_bitint.sql" {
+		t.Errorf("expected 04_add_bitint.sql to differ, got %v, %v, %v", allEqual, list, err)
+	}
+}
+
+// TestUnitMemoryRolledBackHash checks hash of rolled back migration is not reported as applied
+func TestUnitMemoryRolledBackHash(t *testing.T) {
+	repo, set := memoryInit(t, "./migrations/TestRollback")
+	ctx := context.Background()
+
+	if _, err := set.ApplyAll(ctx, false, "dev"); err != nil {
+		t.Fatalf("cannot apply migrations: %s", err)
+	}
+	if _, err := set.Rollback(ctx, "user_users", 1, 3, "dev"); err != nil {
+		t.Fatalf("cannot rollback migrations: %s", err)
+	}
+	checkVersion(t, repo, "user_users", 1)
+
+	sLog := migration_log.MigrationServicesLog{MigrationServiceName: "user_users", Priority: 1, Version: 2, FileName: "02_add_email.sql"}
+	if hash, err := repo.GetHashFromMigrationServiceLog(ctx, sLog); err != nil || hash != "" {
+		t.Errorf("expected no hash of rolled back migration, got %q, %v", hash, err)
+	}
+	sLog.Version, sLog.FileName = 1, "01_init.sql"
+	if hash, err := repo.GetHashFromMigrationServiceLog(ctx, sLog); err != nil || hash == "" {
+		t.Errorf("expected hash of applied migration, got %q, %v", hash, err)
+	}
+}
+
+// TestUnitMemoryApplyService checks service from several priority folders is applied folder by folder
+// with priority of every folder, so its hashes are found and it can be rolled back
+func TestUnitMemoryApplyService(t *testing.T) {
+	ctx := context.Background()
+	fsys := fstest.MapFS{
+		"db/01_user_users/01_init.sql":           {Data: []byte("CREATE TABLE user_users (id int);")},
+		"db/01_user_users/R_users_view.sql":      {Data: []byte("CREATE OR REPLACE VIEW users AS SELECT id FROM user_users;")},
+		"db/03_user_users/02_add_email.sql":      {Data: []byte("ALTER TABLE user_users ADD COLUMN email text;")},
+		"db/03_user_users/02_add_email.down.sql": {Data: []byte("ALTER TABLE user_users DROP COLUMN email;")},
+	}
+	repo := memory.NewRepository()
+	set := migration.New(repo)
+	if err := migration.ReadFS(fsys, "db", set); err != nil {
+		t.Fatalf("cannot read migrations: %s", err)
+	}
+
+	priorities := set.ServicePriorities("user_users")
+	if !reflect.DeepEqual(priorities, []int{1, 3}) {
+		t.Fatalf("expected priorities [1 3], got %v", priorities)
+	}
+	n := 0
+	for _, priority := range priorities {
+		ver, _ := repo.GetServiceVersion(ctx, "user_users")
+		applied, _, err := set.Apply(ctx, "user_users", priority, ver, ver, "dev")
+		if err != nil {
+			t.Fatalf("cannot apply migrations: %s", err)
+		}
+		n += applied
+	}
+	if n != 3 {
+		t.Errorf("expected 2 versions and 1 repeatable applied, got %d", n)
+	}
+	checkVersion(t, repo, "user_users", 2)
+
+	allEqual, list, err := set.CheckMigrationHash(ctx)
+	if err != nil || !allEqual {
+		t.Errorf("expected all hashes equal, got %v, %v", list, err)
+	}
+
+	if _, err := set.Rollback(ctx, "user_users", 1, 2, "dev"); err != nil {
+		t.Fatalf("cannot rollback migrations: %s", err)
+	}
+	sLog := migration_log.MigrationServicesLog{MigrationServiceName: "user_users", Priority: 3, Version: 2, FileName: "02_add_email.sql"}
+	if hash, err := repo.GetHashFromMigrationServiceLog(ctx, sLog); err != nil || hash != "" {
+		t.Errorf("expected no hash of rolled back migration, got %q, %v", hash, err)
+	}
+}
+
+// TestUnitMemoryPlanSnapshot checks plan is built from snapshot versions
+func TestUnitMemoryPlanSnapshot(t *testing.T) {
+	repo, set := memoryInit(t, "./migrations/TestMigrationPriorities")
+	repo.Load(memory.Snapshot{
+		Versions: map[string]int{"user_user": 2},
+		Logs:     []migration_log.MigrationServicesLog{},
+	})
+
+	plan, err := set.Plan(context.Background(), false, "dev")
+	if err != nil {
+		t.Fatalf("cannot plan migrations: %s", err)
+	}
+	if len(plan.Services) != 2 {
+		t.Fatalf("expected 2 services, got %d", len(plan.Services))
+	}
+	if sPlan := plan.Services[0]; len(sPlan.Apply) != 1 || sPlan.Apply[0].Version != 4 || sPlan.ResultVersion != 4 {
+		t.Errorf("expected only version 4 of user_user to apply, got %+v", sPlan)
+	}
+	if sPlan := plan.Services[1]; len(sPlan.Apply) != 2 || sPlan.ResultVersion != 2 {
+		t.Errorf("expected 2 files of email_emails to apply, got %+v", sPlan)
+	}
+	if len(repo.Executed()) != 0 {
+		t.Errorf("plan should not execute anything, got %v", repo.Executed())
+	}
+}
+
+// TestUnitMemoryRepeatable checks repeatable migrations run after versioned ones and again only when changed
+func TestUnitMemoryRepeatable(t *testing.T) {
+	ctx := context.Background()
+	fsys := fstest.MapFS{
+		"db/01_user_users/01_init.sql":            {Data: []byte("CREATE TABLE user_users (id int);")},
+		"db/01_user_users/R_users_view.sql":       {Data: []byte("CREATE OR REPLACE VIEW users AS SELECT id FROM user_users;")},
+		"db/01_user_users/02_add_email.sql":       {Data: []byte("ALTER TABLE user_users ADD COLUMN email text;")},
+		"db/01_user_users/functions/01_email.sql": {Data: []byte("-- repeatable: true\nCREATE OR REPLACE FUNCTION email() RETURNS int AS 'SELECT 1' LANGUAGE sql;")},
+	}
+	repo := memory.NewRepository()
+	apply := func() int {
+		t.Helper()
+		set := migration.New(repo)
+		if err := migration.ReadFS(fsys, "db", set); err != nil {
+			t.Fatalf("cannot read migrations: %s", err)
+		}
+		n, err := set.ApplyAll(ctx, false, "dev")
+		if err != nil {
+			t.Fatalf("cannot apply migrations: %s", err)
+		}
+		return n
+	}
+
+	if n := apply(); n != 4 {
+		t.Errorf("expected 4 applied migrations, got %d", n)
+	}
+	exp := []string{"01_init.sql", "02_add_email.sql", "R_users_view.sql", "01_email.sql"}
+	if files := executedFiles(repo); !reflect.DeepEqual(files, exp) {
+		t.Errorf("expected files %v, got %v", exp, files)
+	}
+	checkVersion(t, repo, "user_users", 2)
+	checkVersion(t, repo, "user_users_functions", 0)
+
+	if n := apply(); n != 0 {
+		t.Errorf("expected nothing to apply for unchanged repeatables, got %d", n)
+	}
+
+	fsys["db/01_user_users/R_users_view.sql"] = &fstest.MapFile{Data: []byte("CREATE OR REPLACE VIEW users AS SELECT id, email FROM user_users;")}
+	executed := len(repo.Executed())
+	if n := apply(); n != 1 || len(repo.Executed()) != executed+1 {
+		t.Errorf("expected changed repeatable to be applied again, got %d", n)
+	}
+}
+
+// TestUnitMemoryTimeout checks exceeded timeout fails migration even with allow_error and is logged
+func TestUnitMemoryTimeout(t *testing.T) {
+	ctx := context.Background()
+	fsys := fstest.MapFS{
+		"db/01_user_users/01_init.sql": {Data: []byte("CREATE TABLE user_users (id int);")},
+		"db/01_user_users/02_slow.sql": {Data: []byte("-- allow_error: true, timeout: 1ns\nCREATE INDEX user_users_id ON user_users (id);")},
+	}
+	repo := memory.NewRepository()
+	set := migration.New(repo)
+	set.SetTimeouts(migration.Timeouts{Migration: time.Hour})
+	if err := migration.ReadFS(fsys, "db", set); err != nil {
+		t.Fatalf("cannot read migrations: %s", err)
+	}
+
+	_, err := set.ApplyAll(ctx, false, "dev")
+	var tErr *adapters.TimeoutError
+	if !errors.Is(err, adapters.ErrTimeout) || !errors.As(err, &tErr) || tErr.Setting != "timeout" || tErr.Timeout != time.Nanosecond {
+		t.Fatalf("expected timeout error of the header, got %v", err)
+	}
+	checkVersion(t, repo, "user_users", 1)
+
+	statuses := make(map[string]string)
+	for _, log := range repo.Snapshot().Logs {
+		statuses[log.FileName] = log.Status
+		if log.Status == migration_log.StatusTimeout && log.Error == "" {
+			t.Errorf("expected error of the timed out migration to be logged")
+		}
+	}
+	exp := map[string]string{"01_init.sql": migration_log.StatusApplied, "02_slow.sql": migration_log.StatusTimeout}
+	if !reflect.DeepEqual(statuses, exp) {
+		t.Errorf("expected log statuses %v, got %v", exp, statuses)
+	}
+}
+
+// TestUnitMemoryRetry checks only transient failures are retried and attempts are logged
+func TestUnitMemoryRetry(t *testing.T) {
+	ctx := context.Background()
+	fsys := fstest.MapFS{
+		"db/01_user_users/01_init.sql":  {Data: []byte("CREATE TABLE user_users (id int);")},
+		"db/01_user_users/02_index.sql": {Data: []byte("CREATE INDEX user_users_id ON user_users (id);")},
+	}
+	apply := func(fail error) (*memory.Repository, error) {
+		repo := memory.NewRepository()
+		repo.FailStatement("CREATE INDEX", fail)
+		set := migration.New(repo)
+		set.SetRetry(migration.Retry{Retries: 2})
+		if err := migration.ReadFS(fsys, "db", set); err != nil {
+			t.Fatalf("cannot read migrations: %s", err)
+		}
+		_, err := set.ApplyAll(ctx, false, "dev")
+		return repo, err
+	}
+	attempts := func(repo *memory.Repository) []int {
+		n := make([]int, 0)
+		for _, log := range repo.Snapshot().Logs {
+			if log.FileName == "02_index.sql" {
+				if log.Status != migration_log.StatusFailed || log.SQLState == "" || log.Duration < 0 {
+					t.Errorf("expected failed attempt with sqlstate, got %+v", log)
+				}
+				n = append(n, log.Attempt)
+			}
+		}
+		return n
+	}
+
+	repo, err := apply(&adapters.TransientError{Code: "40P01", Err: errors.New("deadlock detected")})
+	if !errors.Is(err, adapters.ErrTransient) {
+		t.Fatalf("expected transient error, got %v", err)
+	}
+	if n := attempts(repo); !reflect.DeepEqual(n, []int{1, 2, 3}) {
+		t.Errorf("expected every attempt to be logged, got %v", n)
+	}
+
+	repo, err = apply(&adapters.DBError{Code: "42601", Class: adapters.ErrSyntax, Err: errors.New("syntax error")})
+	if !errors.Is(err, adapters.ErrSyntax) || adapters.SQLState(err) != "42601" || errors.Is(err, adapters.ErrTransient) {
+		t.Fatalf("expected syntax error, got %v", err)
+	}
+	if n := attempts(repo); !reflect.DeepEqual(n, []int{1}) {
+		t.Errorf("expected not transient error not to be retried, got %v attempts", n)
+	}
+}
+
+// TestUnitMemoryAllowErrorCodes checks allow_error with SQLSTATEs tolerates only listed errors and logs them
+func TestUnitMemoryAllowErrorCodes(t *testing.T) {
+	ctx := context.Background()
+	fsys := fstest.MapFS{
+		"db/01_user_users/01_init.sql":      {Data: []byte("-- allow_error: duplicate_table\nCREATE TABLE user_users (id int);")},
+		"db/01_user_users/02_add_email.sql": {Data: []byte("-- allow_error: 42701\nALTER TABLE user_users ADD COLUMN email text;")},
+	}
+	repo := memory.NewRepository()
+	repo.FailStatement("CREATE TABLE", &adapters.DBError{Code: "42P07", Err: errors.New("relation already exists")})
+	repo.FailStatement("ADD COLUMN", &adapters.DBError{Code: "42601", Class: adapters.ErrSyntax, Err: errors.New("syntax error")})
+	set := migration.New(repo)
+	if err := migration.ReadFS(fsys, "db", set); err != nil {
+		t.Fatalf("cannot read migrations: %s", err)
+	}
+
+	if _, err := set.ApplyAll(ctx, false, "dev"); !errors.Is(err, adapters.ErrSyntax) {
+		t.Fatalf("expected not listed syntax error, got %v", err)
+	}
+	checkVersion(t, repo, "user_users", 1)
+
+	statuses := make(map[string]string)
+	for _, log := range repo.Snapshot().Logs {
+		statuses[log.FileName] = log.Status
+	}
+	exp := map[string]string{"01_init.sql": migration_log.StatusTolerated, "02_add_email.sql": migration_log.StatusFailed}
+	if !reflect.DeepEqual(statuses, exp) {
+		t.Errorf("expected log statuses %v, got %v", exp, statuses)
+	}
+}
+
+// TestUnitMemoryDependsOn checks depends_on orders migrations across services and bad graphs are rejected
+func TestUnitMemoryDependsOn(t *testing.T) {
+	ctx := context.Background()
+	fsys := fstest.MapFS{
+		"db/01_user_users/01_init.sql":             {Data: []byte("CREATE TABLE user_users (id int);")},
+		"db/01_user_users/02_add_company.sql":      {Data: []byte("-- depends_on: company_companies@1\nALTER TABLE user_users ADD COLUMN company_id int;")},
+		"db/01_user_users/03_add_email.sql":        {Data: []byte("ALTER TABLE user_users ADD COLUMN email text;")},
+		"db/02_company_companies/01_create.sql":    {Data: []byte("CREATE TABLE company_companies (id int);")},
+		"db/02_company_companies/02_add_owner.sql": {Data: []byte("-- depends_on: user_users\nALTER TABLE company_companies ADD COLUMN owner_id int;")},
+	}
+
+	repo := memory.NewRepository()
+	set := migration.New(repo)
+	if err := migration.ReadFS(fsys, "db", set); err != nil {
+		t.Fatalf("cannot read migrations: %s", err)
+	}
+
+	plan, err := set.Plan(ctx, false, "dev")
+	if err != nil || len(plan.Services) != 4 || plan.Services[1].Service != "company_companies" || plan.Services[2].CurrentVersion != 1 {
+		t.Errorf("expected user_users to be split by company_companies in plan, got %+v, %v", plan.Services, err)
+	}
+
+	if _, err := set.ApplyAll(ctx, false, "dev"); err != nil {
+		t.Fatalf("cannot apply migrations: %s", err)
+	}
+	exp := []string{"01_init.sql", "01_create.sql", "02_add_company.sql", "03_add_email.sql", "02_add_owner.sql"}
+	if files := executedFiles(repo); !reflect.DeepEqual(files, exp) {
+		t.Errorf("expected files %v, got %v", exp, files)
+	}
+	checkVersion(t, repo, "user_users", 3)
+	checkVersion(t, repo, "company_companies", 2)
+
+	cases := map[string]fstest.MapFS{
+		"cycle": {
+			"db/01_user_users/01_init.sql":          {Data: []byte("-- depends_on: company_companies@1\nSELECT 1;")},
+			"db/02_company_companies/01_create.sql": {Data: []byte("-- depends_on: user_users@1\nSELECT 1;")},
+		},
+		"missing version": {
+			"db/01_user_users/01_init.sql": {Data: []byte("-- depends_on: user_users@5\nSELECT 1;")},
+		},
+		"missing service": {
+			"db/01_user_users/01_init.sql": {Data: []byte("-- depends_on: billing\nSELECT 1;")},
+		},
+	}
+	for name, fsys := range cases {
+		set := migration.New(memory.NewRepository())
+		if err := migration.ReadFS(fsys, "db", set); err != nil {
+			t.Fatalf("cannot read migrations: %s", err)
+		}
+		if _, err := set.ApplyAll(ctx, false, "dev"); !errors.Is(err, migration.ErrDependency) {
+			t.Errorf("%s: expected dependency error, got %v", name, err)
+		}
+	}
+}
+
+// TestUnitMemoryParallel checks services of one priority are applied by workers and errors are reported per service
+func TestUnitMemoryParallel(t *testing.T) {
+	ctx := context.Background()
+	fsys := fstest.MapFS{
+		"db/01_user_users/01_init.sql":             {Data: []byte("CREATE TABLE user_users (id int);")},
+		"db/01_user_users/02_add_email.sql":        {Data: []byte("ALTER TABLE user_users ADD COLUMN email text;")},
+		"db/01_email_emails/01_init.sql":           {Data: []byte("CREATE TABLE email_emails (id int);")},
+		"db/01_email_emails/02_add_user.sql":       {Data: []byte("ALTER TABLE email_emails ADD COLUMN user_id int;")},
+		"db/01_company_companies/01_init.sql":      {Data: []byte("CREATE TABLE company_companies (id int);")},
+		"db/01_company_companies/02_add_owner.sql": {Data: []byte("-- depends_on: user_users@2\nALTER TABLE company_companies ADD COLUMN owner_id int;")},
+		"db/02_billing_invoices/01_init.sql":       {Data: []byte("CREATE TABLE billing_invoices (id int);")},
+	}
+	read := func(repo *memory.Repository) *migration.Set {
+		t.Helper()
+		set := migration.New(repo)
+		set.SetWorkers(3)
+		if err := migration.ReadFS(fsys, "db", set); err != nil {
+			t.Fatalf("cannot read migrations: %s", err)
+		}
+		return set
+	}
+
+	repo := memory.NewRepository()
+	n, err := read(repo).ApplyAll(ctx, false, "dev")
+	if err != nil || n != 7 {
+		t.Fatalf("expected 7 applied migrations, got %d, %v", n, err)
+	}
+	order := make(map[string]int)
+	for i, statement := range repo.Executed() {
+		order[statement.File] = i
+	}
+	if order["db/01_user_users/02_add_email.sql"] > order["db/01_company_companies/02_add_owner.sql"] ||
+		order["db/01_email_emails/01_init.sql"] > order["db/01_email_emails/02_add_user.sql"] ||
+		order["db/01_company_companies/02_add_owner.sql"] > order["db/02_billing_invoices/01_init.sql"] {
+		t.Errorf("unexpected order of migrations %v", order)
+	}
+
+	// failed service stops its dependents and the next priority, other services are applied
+	repo = memory.NewRepository()
+	injected := errors.New("injected")
+	repo.FailFile("db/01_user_users/02_add_email.sql", injected)
+	_, err = read(repo).ApplyAll(ctx, false, "dev")
+
+	var applyErr *migration.ApplyError
+	if !errors.As(err, &applyErr) || !errors.Is(err, injected) || len(applyErr.Errors) != 2 {
+		t.Fatalf("expected errors of user_users and company_companies, got %v", err)
+	}
+	if applyErr.Errors[0].Service != "company_companies" || applyErr.Errors[1].Service != "user_users" {
+		t.Errorf("unexpected failed services %v", applyErr.Errors)
+	}
+	checkVersion(t, repo, "email_emails", 2)
+	checkVersion(t, repo, "user_users", 1)
+	checkVersion(t, repo, "company_companies", 1)
+	checkVersion(t, repo, "billing_invoices", 0)
+}
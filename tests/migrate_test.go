@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/webdevelop-pro/migration-service/internal/adapters/repository/memory"
+	"github.com/webdevelop-pro/migration-service/pkg/migrate"
+)
+
+// pinger is a repository which is not supported by the library
+type pinger struct{}
+
+func (pinger) Ping(ctx context.Context) error {
+	return nil
+}
+
+// TestUnitMigrate checks migrations can be planned, applied and checked through the library API
+func TestUnitMigrate(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := migrate.New(migrate.WithFS(embedMigrations, "migrations/TestMigrationPriorities")); err == nil {
+		t.Error("expected error without repository")
+	}
+
+	if _, err := migrate.New(migrate.WithRepository(pinger{}), migrate.WithFS(embedMigrations, "migrations/TestMigrationPriorities")); err == nil {
+		t.Error("expected error of unsupported repository")
+	}
+
+	repo := memory.NewRepository()
+	m, err := migrate.New(
+		migrate.WithRepository(repo),
+		migrate.WithFS(embedMigrations, "migrations/TestMigrationPriorities"),
+		migrate.WithEnv("dev"),
+	)
+	if err != nil {
+		t.Fatalf("cannot create migrator: %s", err)
+	}
+
+	plan, err := m.Plan(ctx)
+	if err != nil || len(plan.Services) != 2 || plan.Services[0].ResultVersion != 4 {
+		t.Errorf("expected plan for 2 services, got %+v, %v", plan, err)
+	}
+
+	n, err := m.Apply(ctx)
+	if err != nil || n != 5 {
+		t.Errorf("expected 5 applied migrations, got %d, %v", n, err)
+	}
+	checkVersion(t, repo, "user_user", 4)
+	checkVersion(t, repo, "email_emails", 2)
+
+	allEqual, changed, err := m.Check(ctx)
+	if err != nil || !allEqual {
+		t.Errorf("expected all hashes equal, got %v, %v", changed, err)
+	}
+}
@@ -0,0 +1,3 @@
+-- no_transaction: true
+CREATE INDEX CONCURRENTLY IF NOT EXISTS user_users_name_idx ON user_users (name);
+CREATE INDEX CONCURRENTLY IF NOT EXISTS user_users_id_name_idx ON user_users (id, name);
@@ -0,0 +1,5 @@
+--- some comment
+CREATE TABLE user_users (
+    id serial not null primary key,
+    name varchar(150) not null default ''
+);
\ No newline at end of file
@@ -0,0 +1,2 @@
+--- required_env: !master
+insert into user_users(name) values('test_user')
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE user_users;
\ No newline at end of file
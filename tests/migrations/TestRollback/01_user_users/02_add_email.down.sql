@@ -0,0 +1 @@
+ALTER TABLE user_users DROP COLUMN email;
\ No newline at end of file
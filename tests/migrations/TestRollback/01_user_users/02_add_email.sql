@@ -0,0 +1,2 @@
+--- some comment
+ALTER TABLE user_users ADD email varchar(150) not null default '';
\ No newline at end of file
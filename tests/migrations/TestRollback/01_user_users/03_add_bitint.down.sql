@@ -0,0 +1 @@
+ALTER TABLE user_users DROP COLUMN external_id;
\ No newline at end of file
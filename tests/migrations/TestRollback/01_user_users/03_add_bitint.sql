@@ -0,0 +1 @@
+ALTER TABLE user_users ADD COLUMN external_id bigint default 0;
\ No newline at end of file
@@ -0,0 +1,2 @@
+--- allow_error: true
+ALTER TABLE user_emails ADD email varchar(150);
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE user_users ADD email varchar(150) not null default '';
+CREATE INDEX user_users_email_idx ON user_users (email);
\ No newline at end of file
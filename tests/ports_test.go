@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration"
+	"github.com/webdevelop-pro/migration-service/internal/ports"
+	"github.com/webdevelop-pro/migration-service/internal/services"
+)
+
+// planMigration is services.Migration which returns fixed plan
+type planMigration struct {
+	services.Migration
+	plan migration.Plan
+}
+
+func (m planMigration) Plan(dir string) (migration.Plan, error) {
+	return m.plan, nil
+}
+
+func (m planMigration) Ping(ctx context.Context) error {
+	return nil
+}
+
+// TestUnitPortsServices checks bearer token is required and service split by depends_on is listed once
+func TestUnitPortsServices(t *testing.T) {
+	mig := planMigration{plan: migration.Plan{Services: []migration.ServicePlan{
+		{Priority: 1, Service: "user", CurrentVersion: 1, ResultVersion: 2, Apply: make([]migration.PlanFile, 1)},
+		{Priority: 2, Service: "email", CurrentVersion: 0, ResultVersion: 1, Apply: make([]migration.PlanFile, 1)},
+		{Priority: 1, Service: "user", CurrentVersion: 2, ResultVersion: 4, Apply: make([]migration.PlanFile, 2)},
+	}}}
+	h := ports.NewHttpServer(mig, &ports.Config{Dir: "migrations", ApiToken: "secret"})
+
+	e := echo.New()
+	for _, header := range []string{"", "secret", "Bearer wrong", "Basic secret"} {
+		req := httptest.NewRequest(http.MethodGet, "/services", nil)
+		req.Header.Set(echo.HeaderAuthorization, header)
+		rec := httptest.NewRecorder()
+		if err := h.Auth(h.ListServices)(e.NewContext(req, rec)); err != nil || rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected %q to be unauthorized, got %d, %v", header, rec.Code, err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/services", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer secret")
+	rec := httptest.NewRecorder()
+	if err := h.Auth(h.ListServices)(e.NewContext(req, rec)); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("expected services to be listed, got %d, %v", rec.Code, err)
+	}
+
+	var list []ports.ServiceResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("cannot decode response: %s", err)
+	}
+	exp := []ports.ServiceResponse{
+		{Name: "user", Priority: 1, Version: 1, LatestVersion: 4, Pending: 3},
+		{Name: "email", Priority: 2, Version: 0, LatestVersion: 1, Pending: 1},
+	}
+	if len(list) != len(exp) || list[0] != exp[0] || list[1] != exp[1] {
+		t.Errorf("expected services %+v, got %+v", exp, list)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/webdevelop-pro/migration-service/internal/adapters"
+	"github.com/webdevelop-pro/migration-service/internal/adapters/repository/sqlite"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration_log"
+)
+
+// TestUnitSQLite checks migrations can be applied to SQLite database
+func TestUnitSQLite(t *testing.T) {
+	ctx := context.Background()
+	repo, err := sqlite.Open(filepath.Join(t.TempDir(), "migrations.db"))
+	if err != nil {
+		t.Fatalf("cannot open sqlite database: %s", err)
+	}
+
+	set := migration.New(repo)
+	if err := migration.ReadDir("./migrations/TestSQLite", "", set); err != nil {
+		t.Fatalf("cannot read migrations: %s", err)
+	}
+	if _, err := set.ApplyAll(context.Background(), false, "dev"); err != nil {
+		t.Fatalf("cannot apply migrations: %s", err)
+	}
+
+	ver, err := repo.GetServiceVersion(ctx, "user_users")
+	if err != nil || ver != 3 {
+		t.Errorf("expected version 3, got %d, %v", ver, err)
+	}
+
+	hash, err := repo.GetHashFromMigrationServiceLog(ctx, migration_log.MigrationServicesLog{
+		MigrationServiceName: "user_users",
+		Priority:             1,
+		Version:              3,
+		FileName:             "03_add_email.sql",
+	})
+	if err != nil || hash == "" {
+		t.Errorf("expected hash of applied migration, got '%s', %v", hash, err)
+	}
+
+	if err := repo.ExecNoTx(ctx, "INSERT INTO user_users (name, email) VALUES ('test', 'test@example.com')"); err != nil {
+		t.Errorf("email column should be added: %s", err)
+	}
+}
+
+// TestUnitSQLiteLogsUpgrade checks migration_service_logs of older versions is upgraded to keep every attempt
+func TestUnitSQLiteLogsUpgrade(t *testing.T) {
+	ctx := context.Background()
+	repo, err := sqlite.Open(filepath.Join(t.TempDir(), "migrations.db"))
+	if err != nil {
+		t.Fatalf("cannot open sqlite database: %s", err)
+	}
+
+	const legacy = `CREATE TABLE migration_service_logs (
+    id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+    migration_services_name varchar(255) NOT NULL,
+    priority integer NOT NULL,
+    version integer NOT NULL,
+    file_name varchar(255) NOT NULL,
+    sql text NOT NULL,
+    hash varchar(255) NOT NULL,
+    created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    rolled_back_at timestamp,
+    CONSTRAINT migration_service_logs_complex_uindex UNIQUE (migration_services_name, priority, version, file_name)
+);
+INSERT INTO migration_service_logs (migration_services_name, priority, version, file_name, sql, hash)
+    VALUES ('user_users', 1, 0, 'view.sql', 'CREATE VIEW v AS SELECT 1;', 'old');`
+	if err := repo.ExecNoTx(ctx, legacy); err != nil {
+		t.Fatalf("cannot create legacy table: %s", err)
+	}
+	if err := repo.CreateMigrationTable(ctx); err != nil {
+		t.Fatalf("cannot upgrade migration tables: %s", err)
+	}
+
+	log := migration_log.MigrationServicesLog{
+		MigrationServiceName: "user_users",
+		Priority:             1,
+		Version:              0,
+		FileName:             "view.sql",
+	}
+	for _, row := range []struct{ hash, status string }{
+		{"new", migration_log.StatusApplied},
+		{"newer", migration_log.StatusFailed},
+	} {
+		log.Hash, log.Status = row.hash, row.status
+		if err := repo.WriteMigrationServiceLog(ctx, log); err != nil {
+			t.Fatalf("cannot write migration log: %s", err)
+		}
+	}
+
+	hash, err := repo.GetHashFromMigrationServiceLog(ctx, log)
+	if err != nil || hash != "new" {
+		t.Errorf("expected hash of the last applied row, got '%s', %v", hash, err)
+	}
+}
+
+// TestUnitSQLiteSchemaVersion checks bookkeeping tables are upgraded once and newer tables are refused
+func TestUnitSQLiteSchemaVersion(t *testing.T) {
+	ctx := context.Background()
+	repo, err := sqlite.Open(filepath.Join(t.TempDir(), "migrations.db"))
+	if err != nil {
+		t.Fatalf("cannot open sqlite database: %s", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := repo.CreateMigrationTable(ctx); err != nil {
+			t.Fatalf("cannot create migration tables: %s", err)
+		}
+	}
+
+	if err := repo.ExecNoTx(ctx, "UPDATE migration_service_meta SET schema_version = schema_version + 1"); err != nil {
+		t.Fatalf("cannot bump schema version: %s", err)
+	}
+	err = repo.CreateMigrationTable(ctx)
+	var vErr *adapters.SchemaVersionError
+	if !errors.Is(err, adapters.ErrSchemaVersion) || !errors.As(err, &vErr) || vErr.Version != vErr.Known+1 {
+		t.Errorf("expected newer schema to be refused, got %v", err)
+	}
+}
+
+// TestUnitSQLiteMissingTables checks dropped bookkeeping tables are created again
+// and a missing column is reported instead of retried forever
+func TestUnitSQLiteMissingTables(t *testing.T) {
+	ctx := context.Background()
+	repo, err := sqlite.Open(filepath.Join(t.TempDir(), "migrations.db"))
+	if err != nil {
+		t.Fatalf("cannot open sqlite database: %s", err)
+	}
+	if err := repo.CreateMigrationTable(ctx); err != nil {
+		t.Fatalf("cannot create migration tables: %s", err)
+	}
+
+	if err := repo.ExecNoTx(ctx, "DROP TABLE migration_services"); err != nil {
+		t.Fatalf("cannot drop migration_services: %s", err)
+	}
+	if ver, err := repo.GetServiceVersion(ctx, "user_users"); err != nil || ver != 0 {
+		t.Errorf("expected migration_services to be created again, got %d, %v", ver, err)
+	}
+
+	if err := repo.ExecNoTx(ctx, "ALTER TABLE migration_service_logs DROP COLUMN git_commit"); err != nil {
+		t.Fatalf("cannot drop git_commit: %s", err)
+	}
+	log := migration_log.MigrationServicesLog{MigrationServiceName: "user_users", Priority: 1, Version: 1, FileName: "01_init.sql"}
+	if err := repo.WriteMigrationServiceLog(ctx, log); err == nil {
+		t.Errorf("expected missing column to be reported")
+	}
+}
+
+// TestUnitSQLitePlanReadOnly checks plan does not create migration tables
+func TestUnitSQLitePlanReadOnly(t *testing.T) {
+	ctx := context.Background()
+	repo, err := sqlite.Open(filepath.Join(t.TempDir(), "migrations.db"))
+	if err != nil {
+		t.Fatalf("cannot open sqlite database: %s", err)
+	}
+
+	set := migration.New(repo)
+	if err := migration.ReadDir("./migrations/TestSQLite", "", set); err != nil {
+		t.Fatalf("cannot read migrations: %s", err)
+	}
+	plan, err := set.Plan(ctx, false, "dev")
+	if err != nil {
+		t.Fatalf("cannot plan migrations: %s", err)
+	}
+	if len(plan.Services) != 1 || plan.Services[0].CurrentVersion != 0 || len(plan.Services[0].Apply) != 3 {
+		t.Errorf("expected all migrations of user_users to be planned, got %+v", plan.Services)
+	}
+
+	for _, table := range []string{"migration_services", "migration_service_logs", "migration_service_meta"} {
+		if err := repo.ExecNoTx(ctx, "SELECT 1 FROM "+table); err == nil {
+			t.Errorf("expected %s not to be created by plan", table)
+		}
+	}
+}
+
+// TestUnitSQLiteNoTransaction checks statements of no_transaction file share a session
+// and failed statement is located in the file
+func TestUnitSQLiteNoTransaction(t *testing.T) {
+	repo, err := sqlite.Open(filepath.Join(t.TempDir(), "migrations.db"))
+	if err != nil {
+		t.Fatalf("cannot open sqlite database: %s", err)
+	}
+
+	fsys := fstest.MapFS{
+		"db/01_user/01_init.sql": {Data: []byte("-- no_transaction: true\n" +
+			"CREATE TEMP TABLE tmp_users (id int);\n" +
+			"INSERT INTO tmp_users VALUES (1);\n" +
+			"INSERT INTO missing_users VALUES (1);\n")},
+	}
+	set := migration.New(repo)
+	if err := migration.ReadFS(fsys, "db", set); err != nil {
+		t.Fatalf("cannot read migrations: %s", err)
+	}
+
+	_, err = set.ApplyAll(context.Background(), false, "dev")
+	var sErr *adapters.StatementError
+	if !errors.As(err, &sErr) {
+		t.Fatalf("expected error of the failed statement, got %v", err)
+	}
+	if sErr.Index != 3 || sErr.Line != 4 || sErr.Column != 1 || !strings.Contains(sErr.Error(), "missing_users") {
+		t.Errorf("expected third statement at line 4 to fail, got %s", sErr)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/webdevelop-pro/migration-service/internal/adapters/repository/memory"
+	"github.com/webdevelop-pro/migration-service/internal/domain/migration"
+)
+
+// TestUnitValidate checks every problem of the tree is reported at once
+func TestUnitValidate(t *testing.T) {
+	fsys := fstest.MapFS{
+		"db/01_user_users/01_init.sql":              {Data: []byte("CREATE TABLE user_users (id int);")},
+		"db/01_user_users/01_init_again.sql":        {Data: []byte("CREATE TABLE user_users (id int);")},
+		"db/01_user_users/03_gap.sql":               {Data: []byte("ALTER TABLE user_users ADD COLUMN a int;")},
+		"db/01_user_users/04_empty.sql":             {Data: []byte("-- nothing here\n")},
+		"db/01_user_users/05_unknown.sql":           {Data: []byte("-- alow_error: true\nSELECT 1;")},
+		"db/01_user_users/06_regex.sql":             {Data: []byte("-- required_env: dev(\nSELECT 1;")},
+		"db/01_user_users/07_no_up.down.sql":        {Data: []byte("SELECT 1;")},
+		"db/01_user_users/first_init.sql":           {Data: []byte("SELECT 1;")},
+		"db/01_user_users/seed_data/01_seed.sql":    {Data: []byte("SELECT 1;")},
+		"db/email/01_init.sql":                      {Data: []byte("SELECT 1;")},
+		"db/x_payments/01_init.sql":                 {Data: []byte("SELECT 1;")},
+		"db/02_email_emails/01_init.sql":            {Data: []byte("SELECT 1;")},
+		"db/02_email_emails/02_depends.sql":         {Data: []byte("-- depends_on: billing@1\nSELECT 1;")},
+		"db/02_email_emails/readme.md":              {Data: []byte("not a migration")},
+		"db/02_email_emails/seeds/01_seed.sql":      {Data: []byte("SELECT 1;")},
+		"db/02_email_emails/seeds/01_seed.down.sql": {Data: []byte("SELECT 1;")},
+	}
+
+	problems := migration.ValidateFS(fsys, "db")
+	if !migration.HasErrors(problems) {
+		t.Fatal("expected errors")
+	}
+
+	exp := map[string]string{
+		"db/01_user_users/01_init_again.sql": "already taken by db/01_user_users/01_init.sql",
+		"db/01_user_users/03_gap.sql":        "gap in numbering",
+		"db/01_user_users/04_empty.sql":      "does not have SQL statements",
+		"db/01_user_users/05_unknown.sql":    "unknown header key 'alow_error'",
+		"db/01_user_users/06_regex.sql":      "invalid required_env regex",
+		"db/01_user_users/07_no_up.down.sql": "does not have up file",
+		"db/01_user_users/first_init.sql":    "<version>_<title>.sql",
+		"db/01_user_users/seed_data":         "should not have underscores",
+		"db/email":                           "<service_index>_<service_name>",
+		"db/x_payments":                      "service index should be a number",
+		"db/02_email_emails/02_depends.sql":  "depends on unknown service billing",
+	}
+	found := make(map[string]bool)
+	for _, p := range problems {
+		if msg, ok := exp[p.Path]; ok && strings.Contains(p.Message, msg) {
+			found[p.Path] = true
+			continue
+		}
+		if p.Path == "db/email/01_init.sql" || strings.HasPrefix(p.Path, "db/01_user_users/seed_data/") {
+			// files of bad folders are reported too
+			continue
+		}
+		t.Errorf("unexpected problem %s", p)
+	}
+	for path, msg := range exp {
+		if !found[path] {
+			t.Errorf("expected problem of %s: %s", path, msg)
+		}
+	}
+	for _, p := range problems {
+		if p.Warning != (p.Path == "db/01_user_users/03_gap.sql" || p.Path == "db/x_payments") {
+			t.Errorf("only gaps and not numeric service indexes should be warnings, got %s", p)
+		}
+	}
+
+	// reader refuses duplicated versions too
+	set := migration.New(memory.NewRepository())
+	if err := migration.ReadFS(fsys, "db", set); err == nil || !strings.Contains(err.Error(), "already taken") {
+		t.Errorf("expected error of duplicated version, got %v", err)
+	}
+}